@@ -2,12 +2,23 @@
 
 package crystalline
 
-import "syscall/js"
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"syscall/js"
+)
 
-var uint8ArrayConstructor js.Value
+var (
+	uint8ArrayConstructor        js.Value
+	uint8ClampedArrayConstructor js.Value
+	arrayBufferConstructor       js.Value
+)
 
 func init() {
 	uint8ArrayConstructor = js.Global().Get("Uint8Array")
+	uint8ClampedArrayConstructor = js.Global().Get("Uint8ClampedArray")
+	arrayBufferConstructor = js.Global().Get("ArrayBuffer")
 }
 
 func convertByteArray(data []byte) (interface{}, error) {
@@ -15,3 +26,58 @@ func convertByteArray(data []byte) (interface{}, error) {
 	js.CopyBytesToJS(outArray, data)
 	return outArray, nil
 }
+
+// bytesToGo accepts any binary JS value, a base64 string, or a plain array of numbers
+func bytesToGo(hint reflect.Type) converter {
+	elementConverter := uintToGo(hint.Elem())
+
+	return func(data js.Value) reflect.Value {
+		if data.IsUndefined() || data.IsNull() {
+			return reflect.Zero(hint)
+		}
+
+		var source js.Value
+		switch {
+		case data.Type() == js.TypeString:
+			decoded, err := base64.StdEncoding.DecodeString(data.String())
+			if err != nil {
+				panic(fmt.Errorf("failed parsing base64 string to bytes: %w", err))
+			}
+			source = uint8ArrayConstructor.New(len(decoded))
+			js.CopyBytesToJS(source, decoded)
+		case data.InstanceOf(uint8ArrayConstructor) || data.InstanceOf(uint8ClampedArrayConstructor):
+			source = data
+		case data.InstanceOf(arrayBufferConstructor):
+			source = uint8ArrayConstructor.New(data)
+		case arrayBufferConstructor.Call("isView", data).Bool():
+			source = uint8ArrayConstructor.New(data.Get("buffer"), data.Get("byteOffset"), data.Get("byteLength"))
+		}
+
+		var length int
+		if source.Truthy() {
+			length = source.Length()
+		} else {
+			length = data.Length()
+		}
+
+		var outValue reflect.Value
+
+		if hint.Kind() == reflect.Slice {
+			outValue = reflect.MakeSlice(hint, length, length)
+		} else {
+			outValue = reflect.New(hint).Elem()
+			length = min(length, hint.Len())
+		}
+
+		if source.Truthy() {
+			js.CopyBytesToGo(typedArrayBytes(outValue), source)
+			return outValue
+		}
+
+		for i := 0; i < length; i++ {
+			outValue.Index(i).Set(elementConverter(data.Index(i)))
+		}
+
+		return outValue
+	}
+}
@@ -0,0 +1,42 @@
+//go:build js
+
+package crystalline
+
+import (
+	"encoding/json"
+	"syscall/js"
+	"testing"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+type Hash []byte
+
+func TestNamedBytes(t *testing.T) {
+	result := MapOrPanic(json.RawMessage(`{}`)).(js.Value)
+	testza.AssertTrue(t, result.InstanceOf(js.Global().Get("Uint8Array")))
+	testza.AssertEqual(t, 2, result.Length())
+
+	result = MapOrPanic([4]byte{1, 2, 3, 4}).(js.Value)
+	testza.AssertTrue(t, result.InstanceOf(js.Global().Get("Uint8Array")))
+	testza.AssertEqual(t, 4, result.Index(3).Int())
+}
+
+func TestBytesInput(t *testing.T) {
+	js.Global().Set("TestBytesInput", MapOrPanic(func(a Hash, b [4]byte) bool {
+		return string(a) == "\x01\x02\x03\x04" && b == [4]byte{1, 2, 3, 4}
+	}))
+
+	js.Global().Get("eval").Invoke(`global.TestBytes = new Uint8Array([1, 2, 3, 4]);`)
+	bytes := js.Global().Get("TestBytes")
+
+	testza.AssertTrue(t, Run([]interface{}{"TestBytesInput"}, bytes, bytes).Bool())
+	testza.AssertTrue(t, Run([]interface{}{"TestBytesInput"}, bytes.Get("buffer"), bytes.Get("buffer")).Bool())
+	testza.AssertTrue(t, Run([]interface{}{"TestBytesInput"}, js.Global().Get("DataView").New(bytes.Get("buffer")), []interface{}{1, 2, 3, 4}).Bool())
+	testza.AssertTrue(t, Run([]interface{}{"TestBytesInput"}, js.Global().Get("Int16Array").New(bytes.Get("buffer")), "AQIDBA==").Bool())
+
+	js.Global().Set("TestBytesNil", MapOrPanic(func(a []byte) bool {
+		return a == nil
+	}))
+	testza.AssertTrue(t, Run([]interface{}{"TestBytesNil"}, nil).Bool())
+}
@@ -0,0 +1,31 @@
+// crystalline-expose generates a function exposing every function of a package
+// marked with a crystalline:expose directive, and implementations of the interfaces
+// marked with a crystalline:implement directive for JS objects. Use it with go:generate:
+//
+//	//go:generate go run github.com/Vilsol/crystalline/cmd/crystalline-expose
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Vilsol/crystalline"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "package directory to scan")
+	out := flag.String("out", "crystalline_expose.go", "file to write, relative to the package directory")
+	funcName := flag.String("func", "ExposeAll", "name of the generated function")
+	flag.Parse()
+
+	source, err := crystalline.GenerateExposeFile(*dir, *funcName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(*dir, *out), source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
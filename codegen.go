@@ -0,0 +1,275 @@
+package crystalline
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const generatedHeader = "// Code generated by crystalline-expose. DO NOT EDIT."
+
+// implementedMethod is a method of an interface implemented by JS objects, with its signature as Go source
+type implementedMethod struct {
+	name    string
+	params  []string
+	args    []string
+	results []string
+}
+
+// GenerateExposeFile generates a Go file for the package in dir, declaring a function named funcName
+// that exposes every exported function with a crystalline:expose directive.
+// Interfaces with a crystalline:implement directive get an implementation calling into JS objects.
+func GenerateExposeFile(dir string, funcName string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading package directory: %w", err)
+	}
+
+	type exposedFunc struct {
+		name    string
+		promise bool
+	}
+
+	pkgName := ""
+	funcs := make([]exposedFunc, 0)
+	interfaces := make(map[string][]implementedMethod)
+	imports := make(map[string]string)
+	fileSet := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fileSet, filepath.Join(dir, entry.Name()), nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %w", entry.Name(), err)
+		}
+
+		// Skip previously generated output
+		if len(f.Comments) > 0 && strings.HasPrefix(f.Comments[0].Text(), strings.TrimPrefix(generatedHeader, "// ")) {
+			continue
+		}
+
+		pkgName = f.Name.Name
+
+		for _, decl := range f.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					interfaceType, ok := typeSpec.Type.(*ast.InterfaceType)
+					if !ok || typeSpec.TypeParams != nil || !typeSpec.Name.IsExported() {
+						continue
+					}
+
+					// The doc of a lone type is on the declaration, grouped types have their own
+					docs := []*ast.CommentGroup{typeSpec.Doc}
+					if len(genDecl.Specs) == 1 {
+						docs = append(docs, genDecl.Doc)
+					}
+
+					directives, err := parseDirectives(docs...)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", typeSpec.Name.Name, err)
+					}
+
+					if !directives.Implement || directives.Ignore {
+						continue
+					}
+
+					methods, err := interfaceMethods(fileSet, interfaceType)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", typeSpec.Name.Name, err)
+					}
+
+					interfaces[typeSpec.Name.Name] = methods
+					usedImports(f, interfaceType, imports)
+				}
+				continue
+			}
+
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv != nil || funcDecl.Type.TypeParams != nil || !funcDecl.Name.IsExported() || funcDecl.Doc == nil {
+				continue
+			}
+
+			directives, err := parseDirectives(funcDecl.Doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", funcDecl.Name.Name, err)
+			}
+
+			if directives.Expose && !directives.Ignore {
+				funcs = append(funcs, exposedFunc{
+					name:    funcDecl.Name.Name,
+					promise: directives.Promise,
+				})
+			}
+		}
+	}
+
+	if pkgName == "" {
+		return nil, fmt.Errorf("no go files found in %s", dir)
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].name < funcs[j].name
+	})
+
+	var source bytes.Buffer
+	source.WriteString(generatedHeader + "\n\n")
+	source.WriteString(fmt.Sprintf("package %s\n\n", pkgName))
+
+	if len(imports) == 0 {
+		source.WriteString("import \"github.com/Vilsol/crystalline\"\n\n")
+	} else {
+		source.WriteString("import (\n")
+		for _, importPath := range SortedKeys(imports) {
+			source.WriteString(fmt.Sprintf("%s %q\n", imports[importPath], importPath))
+		}
+		source.WriteString("\n\"github.com/Vilsol/crystalline\"\n)\n\n")
+	}
+
+	source.WriteString(fmt.Sprintf("// %s exposes every function marked with crystalline:expose\n", funcName))
+	source.WriteString(fmt.Sprintf("func %s(e *crystalline.Exposer) {\n", funcName))
+	for _, fn := range funcs {
+		if fn.promise {
+			source.WriteString(fmt.Sprintf("e.ExposeFuncOrPanicPromise(%s)\n", fn.name))
+		} else {
+			source.WriteString(fmt.Sprintf("e.ExposeFuncOrPanic(%s)\n", fn.name))
+		}
+	}
+	source.WriteString("}\n")
+
+	for _, name := range SortedKeys(interfaces) {
+		writeImplementation(&source, name, interfaces[name])
+	}
+
+	if len(interfaces) > 0 {
+		source.WriteString("\nfunc init() {\n")
+		for _, name := range SortedKeys(interfaces) {
+			source.WriteString(fmt.Sprintf("crystalline.RegisterInterface(func(object crystalline.JSValue) %s {\nreturn js%s{object}\n})\n", name, name))
+		}
+		source.WriteString("}\n")
+	}
+
+	return format.Source(source.Bytes())
+}
+
+// interfaceMethods reads the signatures of the methods declared by an interface
+func interfaceMethods(fileSet *token.FileSet, interfaceType *ast.InterfaceType) ([]implementedMethod, error) {
+	printExpr := func(expr ast.Expr) string {
+		var out bytes.Buffer
+		_ = printer.Fprint(&out, fileSet, expr)
+		return out.String()
+	}
+
+	methods := make([]implementedMethod, 0, len(interfaceType.Methods.List))
+	for _, field := range interfaceType.Methods.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("embedded interfaces cannot be implemented, declare the methods instead")
+		}
+
+		funcType := field.Type.(*ast.FuncType)
+		method := implementedMethod{name: field.Names[0].Name}
+
+		for _, param := range funcType.Params.List {
+			names := make([]string, 0, len(param.Names))
+			for _, name := range param.Names {
+				names = append(names, name.Name)
+			}
+			if len(names) == 0 {
+				names = append(names, "_")
+			}
+
+			for _, name := range names {
+				// Unnamed parameters and the names the implementation uses itself are renamed
+				if name == "_" || name == "adapter" || name == "out" {
+					name = fmt.Sprintf("arg%d", len(method.args)+1)
+				}
+				method.params = append(method.params, name+" "+printExpr(param.Type))
+				method.args = append(method.args, name)
+			}
+		}
+
+		if funcType.Results != nil {
+			for _, result := range funcType.Results.List {
+				for i := 0; i < max(1, len(result.Names)); i++ {
+					method.results = append(method.results, printExpr(result.Type))
+				}
+			}
+		}
+
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
+
+// usedImports records the imports of a file that an interface refers to
+func usedImports(f *ast.File, interfaceType *ast.InterfaceType, imports map[string]string) {
+	ast.Inspect(interfaceType, func(node ast.Node) bool {
+		selector, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selector.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		for _, spec := range f.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			if spec.Name != nil && spec.Name.Name == ident.Name {
+				imports[importPath] = ident.Name
+			} else if spec.Name == nil && path.Base(importPath) == ident.Name {
+				imports[importPath] = ""
+			}
+		}
+
+		return true
+	})
+}
+
+// writeImplementation writes the type implementing an interface by calling the methods of a JS object
+func writeImplementation(source *bytes.Buffer, name string, methods []implementedMethod) {
+	source.WriteString(fmt.Sprintf("\n// js%s implements %s with a JS object\n", name, name))
+	source.WriteString(fmt.Sprintf("type js%s struct {\ncrystalline.JSValue\n}\n", name))
+
+	for _, method := range methods {
+		results := strings.Join(method.results, ", ")
+		if len(method.results) > 1 {
+			results = "(" + results + ")"
+		}
+
+		call := fmt.Sprintf("crystalline.CallMethod[%s](adapter.JSValue, %q", name, method.name)
+		for _, arg := range method.args {
+			call += ", " + arg
+		}
+		call += ")"
+
+		source.WriteString(fmt.Sprintf("\nfunc (adapter js%s) %s(%s) %s {\n", name, method.name, strings.Join(method.params, ", "), results))
+
+		if len(method.results) == 0 {
+			source.WriteString(call + "\n}\n")
+			continue
+		}
+
+		outs := make([]string, len(method.results))
+		for i, result := range method.results {
+			outs[i] = fmt.Sprintf("crystalline.Out[%s](out, %d)", result, i)
+		}
+
+		source.WriteString("out := " + call + "\n")
+		source.WriteString("return " + strings.Join(outs, ", ") + "\n}\n")
+	}
+}
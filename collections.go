@@ -0,0 +1,10 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// convertCollection is just a placeholder
+func convertCollection(_ reflect.Value, _ mapSettings) (interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,270 @@
+//go:build js
+
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"syscall/js"
+)
+
+var (
+	proxyConstructor js.Value
+	reflectGet       js.Value
+	reflectHas       js.Value
+)
+
+func init() {
+	proxyConstructor = js.Global().Get("Proxy")
+	reflectGet = js.Global().Get("Reflect").Get("get")
+	reflectHas = js.Global().Get("Reflect").Get("has")
+}
+
+// convertCollection wraps a settable slice or map in a JS Proxy that reads and writes through to the Go value
+func convertCollection(value reflect.Value, settings mapSettings) (interface{}, error) {
+	return weakCacheFor(value.Type()).Fetch(value.UnsafeAddr(), func() (js.Value, error) {
+		if value.Kind() == reflect.Map {
+			return mapProxy(value, settings)
+		}
+		return sliceProxy(value, settings)
+	})
+}
+
+// rejectAssignment recovers a value a set trap could not convert. Traps cannot return an error, so it is
+// reported like a failed call and the assignment fails, which throws a TypeError in strict mode code.
+func rejectAssignment(accepted *any) {
+	if err := recover(); err != nil {
+		js.Global().Set("goInternalError", fmt.Sprint(err))
+		*accepted = false
+	}
+}
+
+func sliceProxy(value reflect.Value, settings mapSettings) (js.Value, error) {
+	elementConverter, err := jsToGoWith(value.Type().Elem(), converterMode{defaults: settings.defaults()})
+	if err != nil {
+		return js.Null(), err
+	}
+
+	index := func(prop js.Value) (int, bool) {
+		if prop.Type() != js.TypeString {
+			return 0, false
+		}
+
+		i, err := strconv.Atoi(prop.String())
+		if err != nil || i < 0 || strconv.Itoa(i) != prop.String() {
+			return 0, false
+		}
+
+		return i, true
+	}
+
+	resize := func(length int) {
+		if length <= value.Len() {
+			value.Set(value.Slice(0, length))
+			return
+		}
+
+		value.Set(reflect.AppendSlice(value, reflect.MakeSlice(value.Type(), length-value.Len(), length-value.Len())))
+	}
+
+	element := func(i int) interface{} {
+		result, err := mapInternal(value.Index(i), false, false, settings)
+		if err != nil {
+			panic(fmt.Errorf("failed internal mapping: %w", err))
+		}
+		return result
+	}
+
+	handler := map[string]interface{}{
+		"get": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if i, ok := index(args[1]); ok {
+				if i < value.Len() {
+					return element(i)
+				}
+				return js.Undefined()
+			}
+
+			switch args[1].String() {
+			case "length":
+				return value.Len()
+			case "__live":
+				return true
+			}
+
+			return reflectGet.Invoke(args[0], args[1])
+		}),
+		"set": js.FuncOf(func(_ js.Value, args []js.Value) (accepted any) {
+			defer rejectAssignment(&accepted)
+
+			if i, ok := index(args[1]); ok {
+				// The slice is only resized once the value converted
+				var converted reflect.Value
+				if elementConverter != nil {
+					converted = elementConverter(args[2])
+				}
+
+				if i >= value.Len() {
+					resize(i + 1)
+				}
+
+				if converted.IsValid() {
+					value.Index(i).Set(converted)
+				}
+				return true
+			}
+
+			if args[1].String() == "length" {
+				resize(args[2].Int())
+				return true
+			}
+
+			return false
+		}),
+		"deleteProperty": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if i, ok := index(args[1]); ok && i < value.Len() {
+				value.Index(i).Set(reflect.Zero(value.Type().Elem()))
+			}
+			return true
+		}),
+		"has": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if i, ok := index(args[1]); ok {
+				return i < value.Len()
+			}
+			return reflectHas.Invoke(args[0], args[1])
+		}),
+		"ownKeys": js.FuncOf(func(_ js.Value, _ []js.Value) any {
+			keys := make([]interface{}, value.Len()+1)
+			for i := 0; i < value.Len(); i++ {
+				keys[i] = strconv.Itoa(i)
+			}
+			keys[value.Len()] = "length"
+			return keys
+		}),
+		"getOwnPropertyDescriptor": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if i, ok := index(args[1]); ok && i < value.Len() {
+				return map[string]interface{}{
+					"value":        element(i),
+					"writable":     true,
+					"enumerable":   true,
+					"configurable": true,
+				}
+			}
+
+			if args[1].Type() == js.TypeString && args[1].String() == "length" {
+				return map[string]interface{}{
+					"value":        value.Len(),
+					"writable":     true,
+					"enumerable":   false,
+					"configurable": false,
+				}
+			}
+
+			return js.Undefined()
+		}),
+	}
+
+	return proxyConstructor.New(js.ValueOf([]interface{}{}), handler), nil
+}
+
+func mapProxy(value reflect.Value, settings mapSettings) (js.Value, error) {
+	keyConverter, err := jsToGoWith(value.Type().Key(), converterMode{defaults: settings.defaults()})
+	if err != nil {
+		return js.Null(), err
+	}
+
+	elementConverter, err := jsToGoWith(value.Type().Elem(), converterMode{defaults: settings.defaults()})
+	if err != nil {
+		return js.Null(), err
+	}
+
+	lookup := func(prop js.Value) (key reflect.Value, ok bool) {
+		if prop.Type() != js.TypeString || keyConverter == nil {
+			return reflect.Value{}, false
+		}
+
+		// Property names that are not valid keys (e.g. "toString" on an int map) are not map entries
+		defer func() {
+			if recover() != nil {
+				key, ok = reflect.Value{}, false
+			}
+		}()
+
+		key = keyConverter(prop)
+		return key, value.MapIndex(key).IsValid()
+	}
+
+	element := func(key reflect.Value) interface{} {
+		result, err := mapInternal(value.MapIndex(key), false, false, settings)
+		if err != nil {
+			panic(fmt.Errorf("failed internal mapping: %w", err))
+		}
+		return result
+	}
+
+	handler := map[string]interface{}{
+		"get": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if key, ok := lookup(args[1]); ok {
+				return element(key)
+			}
+
+			if args[1].Type() == js.TypeString && args[1].String() == "__live" {
+				return true
+			}
+
+			return reflectGet.Invoke(args[0], args[1])
+		}),
+		"set": js.FuncOf(func(_ js.Value, args []js.Value) (accepted any) {
+			defer rejectAssignment(&accepted)
+
+			if args[1].Type() != js.TypeString || keyConverter == nil || elementConverter == nil {
+				return false
+			}
+
+			key, converted := keyConverter(args[1]), elementConverter(args[2])
+			if value.IsNil() {
+				value.Set(reflect.MakeMap(value.Type()))
+			}
+
+			value.SetMapIndex(key, converted)
+			return true
+		}),
+		"deleteProperty": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if key, ok := lookup(args[1]); ok {
+				value.SetMapIndex(key, reflect.Value{})
+			}
+			return true
+		}),
+		"has": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if _, ok := lookup(args[1]); ok {
+				return true
+			}
+			return reflectHas.Invoke(args[0], args[1])
+		}),
+		"ownKeys": js.FuncOf(func(_ js.Value, _ []js.Value) any {
+			keys := make([]interface{}, 0, value.Len())
+			i := value.MapRange()
+			for i.Next() {
+				key, err := mapInternal(i.Key(), false, false, settings)
+				if err != nil {
+					panic(fmt.Errorf("failed internal mapping: %w", err))
+				}
+				keys = append(keys, fmt.Sprint(key))
+			}
+			return keys
+		}),
+		"getOwnPropertyDescriptor": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if key, ok := lookup(args[1]); ok {
+				return map[string]interface{}{
+					"value":        element(key),
+					"writable":     true,
+					"enumerable":   true,
+					"configurable": true,
+				}
+			}
+			return js.Undefined()
+		}),
+	}
+
+	return proxyConstructor.New(js.ValueOf(map[string]interface{}{}), handler), nil
+}
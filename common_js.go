@@ -6,29 +6,319 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"reflect"
 	"strconv"
+	"sync"
 	"syscall/js"
 )
 
 type converter = func(data js.Value) reflect.Value
 
-var jsToGoCache map[reflect.Type]converter
+// converterMode separates the converters of a type. Strict ones reject values that do not match the Go type,
+// async ones are used for the arguments of promise functions, whose callbacks may return a promise Go awaits.
+type converterMode struct {
+	strict bool
+	async  bool
+	// defaults are the settings the arguments Go passes to JS callbacks are mapped with
+	defaults mappingDefaults
+}
+
+// mappingDefaults are the mapSettings inherited by nested values, in a form that can be part of a cache key
+type mappingDefaults struct {
+	structMode StructMode
+	view       bool
+	nilMode    NilMode
+	options    *Options
+}
+
+func (s mapSettings) defaults() mappingDefaults {
+	return mappingDefaults{
+		structMode: s.defaultMode,
+		view:       s.defaultView,
+		nilMode:    s.nilMode,
+		options:    s.options,
+	}
+}
+
+func (d mappingDefaults) settings() mapSettings {
+	return mapSettings{
+		defaultMode: d.structMode,
+		defaultView: d.view,
+		nilMode:     d.nilMode,
+		options:     d.options,
+	}
+}
+
+type converterKey struct {
+	hint reflect.Type
+	mode converterMode
+}
+
+var (
+	jsToGoCache   map[converterKey]converter
+	jsToGoPending map[converterKey]*converter
+	jsToGoBuilt   []converterKey
+	jsToGoMutex   sync.Mutex
+	isArrayFunc   js.Value
+	isViewFunc    js.Value
+	keysFunc      js.Value
+)
 
 func init() {
-	jsToGoCache = make(map[reflect.Type]converter)
+	jsToGoCache = make(map[converterKey]converter)
+	jsToGoPending = make(map[converterKey]*converter)
+	isArrayFunc = js.Global().Get("Array").Get("isArray")
+	isViewFunc = js.Global().Get("ArrayBuffer").Get("isView")
+	keysFunc = js.Global().Get("Object").Get("keys")
 }
 
 func jsToGo(hint reflect.Type) (converter, error) {
-	if found, ok := jsToGoCache[hint]; ok {
+	return jsToGoWith(hint, converterMode{})
+}
+
+func jsToGoWith(hint reflect.Type, mode converterMode) (converter, error) {
+	return buildJsToGo(func() (converter, error) {
+		return cachedJsToGo(hint, mode)
+	})
+}
+
+// buildJsToGo holds jsToGoMutex while building. When the build fails, the converters cached on the way
+// are dropped, as they may call the pending converter that was never completed. Converters are only built
+// while it is held, never run, and recursive types resolve through jsToGoPending, so it is never re-entered.
+func buildJsToGo[T any](build func() (T, error)) (T, error) {
+	jsToGoMutex.Lock()
+	defer jsToGoMutex.Unlock()
+
+	jsToGoBuilt = jsToGoBuilt[:0]
+	result, err := build()
+	if err != nil {
+		for _, key := range jsToGoBuilt {
+			delete(jsToGoCache, key)
+		}
+	}
+	jsToGoBuilt = jsToGoBuilt[:0]
+
+	return result, err
+}
+
+// cachedJsToGo must be called with jsToGoMutex held, converters are only cached once complete
+func cachedJsToGo(hint reflect.Type, mode converterMode) (converter, error) {
+	key := converterKey{hint: hint, mode: mode}
+	if found, ok := jsToGoCache[key]; ok {
 		return found, nil
 	}
 
+	// A recursive type refers to itself while being built, so it gets a converter resolved once it is complete
+	if pending, ok := jsToGoPending[key]; ok {
+		return func(data js.Value) reflect.Value {
+			return (*pending)(data)
+		}, nil
+	}
+
+	pending := new(converter)
+	jsToGoPending[key] = pending
+	defer delete(jsToGoPending, key)
+
+	result, err := newJsToGo(hint, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if result != nil && isEnum(hint) {
+		result = enumToGo(result)
+	}
+
+	if result != nil && mode.strict {
+		result = strictToGo(hint, result)
+	}
+
+	*pending = result
+	jsToGoCache[key] = result
+	jsToGoBuilt = append(jsToGoBuilt, key)
+
+	return result, nil
+}
+
+// enumToGo rejects values that are not one of the constants of a crystalline:enum strict type
+func enumToGo(inner converter) converter {
+	return func(data js.Value) reflect.Value {
+		value := inner(data)
+		if err := validateEnum(value); err != nil {
+			panic(&ValidationError{Message: err.Error()})
+		}
+		return value
+	}
+}
+
+// strictToGo checks the JS type of a value before converting it
+func strictToGo(hint reflect.Type, inner converter) converter {
+	return func(data js.Value) reflect.Value {
+		if err := checkJSType(hint, data); err != nil {
+			panic(err)
+		}
+		return inner(data)
+	}
+}
+
+// checkJSType returns why a JS value cannot be converted to a Go type without losing data
+func checkJSType(hint reflect.Type, data js.Value) *ValidationError {
+	if data.IsUndefined() || data.IsNull() {
+		switch hint.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func, reflect.Interface:
+			return nil
+		}
+
+		if isHandle(hint) {
+			return nil
+		}
+
+		if data.IsUndefined() {
+			return &ValidationError{Message: "is required"}
+		}
+		return mismatch(jsTypeName(hint), data)
+	}
+
+	switch hint.Kind() {
+	case reflect.Bool:
+		if data.Type() != js.TypeBoolean {
+			return mismatch("boolean", data)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if data.Type() != js.TypeNumber {
+			return mismatch("integer", data)
+		}
+
+		number := data.Float()
+		if number != math.Trunc(number) {
+			return &ValidationError{Message: fmt.Sprintf("expected integer, got %v", number)}
+		}
+
+		if minimum, maximum := intRange(hint); number < minimum || number > maximum {
+			return &ValidationError{Message: fmt.Sprintf("%v overflows %s", number, hint.String())}
+		}
+	case reflect.Float32, reflect.Float64:
+		if data.Type() != js.TypeNumber {
+			return mismatch("number", data)
+		}
+	case reflect.String:
+		if data.Type() != js.TypeString {
+			return mismatch("string", data)
+		}
+	case reflect.Array, reflect.Slice:
+		// Bytes are also accepted as strings and buffers
+		if isBytes(hint) {
+			return nil
+		}
+
+		if !isArrayFunc.Invoke(data).Bool() && !isViewFunc.Invoke(data).Bool() {
+			return mismatch("array", data)
+		}
+
+		if hint.Kind() == reflect.Array && data.Length() != hint.Len() {
+			return &ValidationError{Message: fmt.Sprintf("expected %d items, got %d", hint.Len(), data.Length())}
+		}
+	case reflect.Map, reflect.Struct:
+		if isHandle(hint) {
+			return nil
+		}
+
+		if data.Type() != js.TypeObject || isArrayFunc.Invoke(data).Bool() {
+			return mismatch("object", data)
+		}
+	case reflect.Func:
+		if data.Type() != js.TypeFunction {
+			return mismatch("function", data)
+		}
+	case reflect.Interface:
+		if data.Type() != js.TypeObject {
+			return mismatch("object", data)
+		}
+	}
+
+	return nil
+}
+
+func mismatch(expected string, data js.Value) *ValidationError {
+	actual := data.Type().String()
+	if data.IsNull() {
+		actual = "null"
+	} else if isArrayFunc.Invoke(data).Bool() {
+		actual = "array"
+	}
+
+	return &ValidationError{Message: fmt.Sprintf("expected %s, got %s", expected, actual)}
+}
+
+// jsTypeName names the JS type expected for a Go type that cannot be null
+func jsTypeName(hint reflect.Type) string {
+	switch hint.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Array:
+		return "array"
+	case reflect.Struct:
+		return "object"
+	}
+
+	if isNumber(hint) {
+		return "integer"
+	}
+
+	return hint.String()
+}
+
+// intRange returns the values an integer type can hold, 64 bit types are bound by what a JS number holds exactly
+func intRange(hint reflect.Type) (float64, float64) {
+	unsigned := hint.Kind() >= reflect.Uint && hint.Kind() <= reflect.Uintptr
+	if hint.Bits() == 64 {
+		if unsigned {
+			return 0, maxSafeInteger
+		}
+		return -maxSafeInteger, maxSafeInteger
+	}
+
+	if unsigned {
+		return 0, float64(uint64(1)<<hint.Bits() - 1)
+	}
+	return -float64(int64(1) << (hint.Bits() - 1)), float64(int64(1)<<(hint.Bits()-1) - 1)
+}
+
+const maxSafeInteger = 1<<53 - 1
+
+// convertAt converts a nested value, prefixing the path of validation errors with where it was found
+func convertAt(conv converter, data js.Value, segment string) reflect.Value {
+	defer func() {
+		if err := recover(); err != nil {
+			if validationErr, ok := err.(*ValidationError); ok {
+				panic(validationErr.at(segment))
+			}
+			panic(err)
+		}
+	}()
+
+	return conv(data)
+}
+
+// fieldSegment is the path segment of a property, quoted if it is not an identifier
+func fieldSegment(name string) string {
+	if jsIdentifier.MatchString(name) {
+		return "." + name
+	}
+	return "[" + strconv.Quote(name) + "]"
+}
+
+func newJsToGo(hint reflect.Type, mode converterMode) (converter, error) {
 	switch hint.Kind() {
 	case reflect.Invalid:
 		return nil, errors.New("invalid value kind")
 	case reflect.Bool:
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
@@ -36,46 +326,33 @@ func jsToGo(hint reflect.Type) (converter, error) {
 			newValue.SetBool(data.Bool())
 			return newValue
 		}
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Int:
-		jsToGoCache[hint] = intToGo(hint)
-		return jsToGoCache[hint], nil
+		return intToGo(hint), nil
 	case reflect.Int8:
-		jsToGoCache[hint] = intToGo(hint)
-		return jsToGoCache[hint], nil
+		return intToGo(hint), nil
 	case reflect.Int16:
-		jsToGoCache[hint] = intToGo(hint)
-		return jsToGoCache[hint], nil
+		return intToGo(hint), nil
 	case reflect.Int32:
-		jsToGoCache[hint] = intToGo(hint)
-		return jsToGoCache[hint], nil
+		return intToGo(hint), nil
 	case reflect.Int64:
-		jsToGoCache[hint] = intToGo(hint)
-		return jsToGoCache[hint], nil
+		return intToGo(hint), nil
 	case reflect.Uint:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Uint8:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Uint16:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Uint32:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Uint64:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Uintptr:
-		jsToGoCache[hint] = uintToGo(hint)
-		return jsToGoCache[hint], nil
+		return uintToGo(hint), nil
 	case reflect.Float32:
-		jsToGoCache[hint] = floatToGo(hint)
-		return jsToGoCache[hint], nil
+		return floatToGo(hint), nil
 	case reflect.Float64:
-		jsToGoCache[hint] = floatToGo(hint)
-		return jsToGoCache[hint], nil
+		return floatToGo(hint), nil
 	case reflect.Complex64:
 		slog.Error("complex64 is not supported as argument type. value will not get converted")
 		return nil, nil
@@ -83,18 +360,31 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		slog.Error("complex128 is not supported as argument type. value will not get converted")
 		return nil, nil
 	case reflect.Array:
+		if isBytes(hint) {
+			return bytesToGo(hint), nil
+		}
+
 		var elementConverter converter
+		paths := mode.strict || hasValidation(hint, make(map[reflect.Type]bool))
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
 
+			if typed, ok := typedArrayToGo(hint, data); ok {
+				return typed
+			}
+
 			outArray := reflect.New(hint).Elem()
 
 			if elementConverter != nil {
 				for i := 0; i < data.Length(); i++ {
-					outArray.Index(i).Set(elementConverter(data.Index(i)))
+					if paths {
+						outArray.Index(i).Set(convertAt(elementConverter, data.Index(i), "["+strconv.Itoa(i)+"]"))
+					} else {
+						outArray.Index(i).Set(elementConverter(data.Index(i)))
+					}
 				}
 			}
 
@@ -102,21 +392,23 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		}
 
 		var err error
-		elementConverter, err = jsToGo(hint.Elem())
+		elementConverter, err = cachedJsToGo(hint.Elem(), mode)
 		if err != nil {
 			return nil, err
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Chan:
 		slog.Error("channels are not supported as argument types. value will not get converted")
 		return nil, nil
 	case reflect.Func:
 		converters := make([]converter, hint.NumOut())
+		returnsError := hint.NumOut() > 0 && hint.Out(hint.NumOut()-1) == errorType
 
 		isArrayFn := js.Global().Get("Array").Get("isArray")
+		settings := mode.defaults.settings()
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
@@ -125,35 +417,41 @@ func jsToGo(hint reflect.Type) (converter, error) {
 				inMapped := make([]interface{}, len(in))
 				for i, value := range in {
 					var err error
-					inMapped[i], err = mapInternal(value, false, false)
+					inMapped[i], err = mapInternal(value, false, false, settings)
 					if err != nil {
 						panic(fmt.Errorf("failed internal mapping: %w", err))
 					}
 				}
 
-				response := data.Invoke(inMapped...)
-				realResponse := response
-
-				if response.Type() == js.TypeObject && response.Get("then").Type() == js.TypeFunction {
-					res, err := await(response)
+				outMapped := make([]reflect.Value, hint.NumOut())
+				for i := range outMapped {
+					outMapped[i] = reflect.Zero(hint.Out(i))
+				}
 
-					if err != nil {
-						panic(fmt.Errorf("failed awaiting response: %v", err))
+				response, jsErr := callCallback(data, inMapped, mode.async)
+				if jsErr != nil {
+					if !returnsError {
+						panic(jsErr)
 					}
+					outMapped[len(outMapped)-1] = reflect.ValueOf(&jsErr).Elem().Convert(errorType)
+					return outMapped
+				}
 
-					realResponse = res[0]
+				// The trailing error is reported by throwing, so it is not part of the JS result
+				values := hint.NumOut()
+				if returnsError {
+					values--
 				}
 
-				outMapped := make([]reflect.Value, hint.NumOut())
-				if isArrayFn.Invoke(realResponse).Bool() && hint.NumOut() > 1 {
-					for i := 0; i < realResponse.Length(); i++ {
+				if isArrayFn.Invoke(response).Bool() && values > 1 {
+					for i := 0; i < response.Length() && i < values; i++ {
 						if converters[i] != nil {
-							outMapped[i] = converters[i](realResponse.Index(i))
+							outMapped[i] = converters[i](response.Index(i))
 						}
 					}
-				} else if hint.NumOut() > 0 {
+				} else if values > 0 {
 					if converters[0] != nil {
-						outMapped[0] = converters[0](realResponse)
+						outMapped[0] = converters[0](response)
 					}
 				}
 
@@ -162,25 +460,40 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		}
 
 		for i := 0; i < hint.NumOut(); i++ {
+			if returnsError && i == hint.NumOut()-1 {
+				break
+			}
+
 			var err error
-			converters[i], err = jsToGo(hint.Out(i))
+			// Results of callbacks are converted while the callback returns, so they are never awaited
+			converters[i], err = cachedJsToGo(hint.Out(i), converterMode{defaults: mode.defaults})
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Interface:
+		if implement := implementation(hint); implement != nil {
+			return func(data js.Value) reflect.Value {
+				result := reflect.New(hint).Elem()
+				if !data.IsUndefined() && !data.IsNull() {
+					result.Set(reflect.ValueOf(implement(JSValue{Value: data, mode: mode})))
+				}
+				return result
+			}, nil
+		}
+
 		slog.Error("interfaces are not supported as argument types. value will not get converted", slog.String("hint", hint.String()))
-		jsToGoCache[hint] = nil
 		return nil, nil
 	case reflect.Map:
 		var keyConverter converter
 		var elementConverter converter
+		paths := mode.strict || hasValidation(hint, make(map[reflect.Type]bool))
 
 		entriesFunc := js.Global().Get("Object").Get("entries")
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
@@ -196,7 +509,11 @@ func jsToGo(hint reflect.Type) (converter, error) {
 					var cVal = reflect.ValueOf(nil)
 					if elementConverter != nil {
 						value := entryValues.Index(i).Index(1)
-						cVal = elementConverter(value)
+						if paths {
+							cVal = convertAt(elementConverter, value, "["+strconv.Quote(key.String())+"]")
+						} else {
+							cVal = elementConverter(value)
+						}
 					}
 
 					outMap.SetMapIndex(cKey, cVal)
@@ -207,21 +524,21 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		}
 
 		var err error
-		keyConverter, err = jsToGo(hint.Key())
+		keyConverter, err = cachedJsToGo(hint.Key(), converterMode{defaults: mode.defaults})
 		if err != nil {
 			return nil, err
 		}
 
-		elementConverter, err = jsToGo(hint.Elem())
+		elementConverter, err = cachedJsToGo(hint.Elem(), mode)
 		if err != nil {
 			return nil, err
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Pointer:
 		var valueConverter converter
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
@@ -233,28 +550,29 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		}
 
 		var err error
-		valueConverter, err = jsToGo(hint.Elem())
+		valueConverter, err = cachedJsToGo(hint.Elem(), mode)
 		if err != nil {
 			return nil, err
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Slice:
-		if hint.String() == "[]uint8" {
-			return func(data js.Value) reflect.Value {
-				outSlice := reflect.MakeSlice(hint, data.Length(), data.Length())
-				js.CopyBytesToGo(outSlice.Interface().([]uint8), data)
-				return outSlice
-			}, nil
+		if isBytes(hint) {
+			return bytesToGo(hint), nil
 		}
 
 		var elementConverter converter
+		paths := mode.strict || hasValidation(hint, make(map[reflect.Type]bool))
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
 
+			if typed, ok := typedArrayToGo(hint, data); ok {
+				return typed
+			}
+
 			length := 0
 			if !data.IsNull() && !data.IsUndefined() && !data.IsNaN() {
 				length = data.Length()
@@ -264,7 +582,11 @@ func jsToGo(hint reflect.Type) (converter, error) {
 
 			if elementConverter != nil {
 				for i := 0; i < length; i++ {
-					outSlice.Index(i).Set(elementConverter(data.Index(i)))
+					if paths {
+						outSlice.Index(i).Set(convertAt(elementConverter, data.Index(i), "["+strconv.Itoa(i)+"]"))
+					} else {
+						outSlice.Index(i).Set(elementConverter(data.Index(i)))
+					}
 				}
 			}
 
@@ -272,14 +594,14 @@ func jsToGo(hint reflect.Type) (converter, error) {
 		}
 
 		var err error
-		elementConverter, err = jsToGo(hint.Elem())
+		elementConverter, err = cachedJsToGo(hint.Elem(), mode)
 		if err != nil {
 			return nil, err
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.String:
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
@@ -291,35 +613,49 @@ func jsToGo(hint reflect.Type) (converter, error) {
 			return reflect.ValueOf(data.String())
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.Struct:
-		converters := make(map[string]converter, hint.NumField())
+		if isHandle(hint) {
+			return func(data js.Value) reflect.Value {
+				return handleToGo(hint, data)
+			}, nil
+		}
+
+		fields, names, err := exposedFields(hint)
+		if err != nil {
+			return nil, err
+		}
+
+		setters := make([]fieldSetter, len(fields))
+		known := make(map[string]bool, len(fields))
 
-		jsToGoCache[hint] = func(data js.Value) reflect.Value {
+		result := func(data js.Value) reflect.Value {
 			if data.IsUndefined() || data.IsNull() {
 				return reflect.Zero(hint)
 			}
 
+			if mode.strict {
+				checkProperties(data, known)
+			}
+
 			outStruct := reflect.New(hint).Elem()
-			for i := 0; i < hint.NumField(); i++ {
-				field := hint.Field(i)
-				if converters[field.Name] != nil {
-					outStruct.Field(i).Set(converters[field.Name](data.Get(field.Name)))
+			for n, i := range fields {
+				if setters[n] != nil {
+					setters[n](data.Get(names[n]), outStruct.Field(i))
 				}
 			}
 			return outStruct
 		}
 
-		for i := 0; i < hint.NumField(); i++ {
-			field := hint.Field(i)
-			var err error
-			converters[field.Name], err = jsToGo(field.Type)
+		for n, i := range fields {
+			setters[n], err = fieldToGo(hint.Field(i), names[n], mode)
 			if err != nil {
 				return nil, err
 			}
+			known[names[n]] = true
 		}
 
-		return jsToGoCache[hint], nil
+		return result, nil
 	case reflect.UnsafePointer:
 		slog.Error("unsafe pointers are not supported as argument types. value will not get converted")
 		return nil, nil
@@ -330,6 +666,86 @@ func jsToGo(hint reflect.Type) (converter, error) {
 	}, nil
 }
 
+// fieldSetter converts the JS value of a struct field into it
+type fieldSetter = func(data js.Value, out reflect.Value)
+
+// fieldToGo returns the setter of a struct field, which applies not_nil and the validate tag,
+// or nil if the field cannot be converted. It must be called with jsToGoMutex held.
+func fieldToGo(field reflect.StructField, name string, mode converterMode) (fieldSetter, error) {
+	conv, err := cachedJsToGo(field.Type, mode)
+	if err != nil || conv == nil {
+		return nil, err
+	}
+
+	rules, err := parseValidationRules(field)
+	if err != nil {
+		return nil, err
+	}
+
+	notNil := hasTagOption(field, "not_nil")
+	paths := mode.strict || hasValidation(field.Type, make(map[reflect.Type]bool))
+	segment := fieldSegment(name)
+
+	return func(data js.Value, out reflect.Value) {
+		if mode.strict && notNil && (data.IsUndefined() || data.IsNull()) {
+			panic(&ValidationError{Path: segment, Message: "is required"})
+		}
+
+		if paths {
+			out.Set(convertAt(conv, data, segment))
+		} else {
+			out.Set(conv(data))
+		}
+
+		if notNil {
+			fillNil(out)
+		}
+
+		if rules != nil {
+			if err := rules.check(out); err != nil {
+				panic(&ValidationError{Path: segment, Message: err.Error()})
+			}
+		}
+	}, nil
+}
+
+// jsFieldToGo returns the setter of a struct field, for live structs assigned from JS
+func jsFieldToGo(field reflect.StructField, name string, strict bool, settings mapSettings) (fieldSetter, error) {
+	return buildJsToGo(func() (fieldSetter, error) {
+		return fieldToGo(field, name, converterMode{strict: strict, defaults: settings.defaults()})
+	})
+}
+
+// checkProperties rejects properties that are not fields of the struct. Functions are not data,
+// so the methods of objects mapped from Go can be passed back.
+func checkProperties(data js.Value, known map[string]bool) {
+	keys := keysFunc.Invoke(data)
+	for i := 0; i < keys.Length(); i++ {
+		key := keys.Index(i).String()
+		if !known[key] && data.Get(key).Type() != js.TypeFunction {
+			panic(&ValidationError{Path: fieldSegment(key), Message: "unknown property"})
+		}
+	}
+}
+
+// fillNil replaces a nil slice, map or pointer with an empty value, mirroring not_nil in mapInternal
+func fillNil(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.IsNil() {
+			value.Set(reflect.MakeSlice(value.Type(), 0, 0))
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+	}
+}
+
 func intToGo(hint reflect.Type) converter {
 	return func(data js.Value) reflect.Value {
 		if data.IsUndefined() || data.IsNull() {
@@ -411,6 +827,45 @@ func floatToGo(hint reflect.Type) converter {
 	}
 }
 
+// callCallback invokes a JS callback and awaits the promise it may return if it is async,
+// reporting thrown exceptions and rejections as a JSError
+func callCallback(callback js.Value, args []interface{}, async bool) (result js.Value, jsErr *JSError) {
+	defer func() {
+		if err := recover(); err != nil {
+			thrown, ok := err.(js.Error)
+			if !ok {
+				panic(err)
+			}
+			jsErr = newJSError(thrown.Value)
+		}
+	}()
+
+	response := callback.Invoke(args...)
+	if response.Type() != js.TypeObject || response.Get("then").Type() != js.TypeFunction {
+		return response, nil
+	}
+
+	// Callbacks of synchronous functions run while JS waits for the call, so the promise could never settle
+	if !async {
+		panic(errors.New("a JS callback returned a promise, only callbacks passed to functions exposed as promises can be awaited"))
+	}
+
+	res, rejected := await(response)
+	if rejected != nil {
+		reason := js.Undefined()
+		if len(rejected) > 0 {
+			reason = rejected[0]
+		}
+		return js.Undefined(), newJSError(reason)
+	}
+
+	if len(res) == 0 {
+		return js.Undefined(), nil
+	}
+
+	return res[0], nil
+}
+
 func await(awaitable js.Value) ([]js.Value, []js.Value) {
 	then := make(chan []js.Value)
 	defer close(then)
@@ -2,11 +2,21 @@ package crystalline
 
 import (
 	"context"
+	"reflect"
 	"strings"
 )
 
 var stepKey struct{}
 
+type (
+	mapSettingsKey struct{}
+	addressableKey struct{}
+	inputKey       struct{}
+	aliasBodyKey   struct{}
+	enumStyleKey   struct{}
+	asyncKey       struct{}
+)
+
 func withContextStep(ctx context.Context, step string) context.Context {
 	var steps []string
 	if value := ctx.Value(stepKey); value != nil {
@@ -25,3 +35,63 @@ func getContextSteps(ctx context.Context) string {
 	}
 	return strings.Join(value.([]string), ".")
 }
+
+func withMapSettings(ctx context.Context, settings mapSettings) context.Context {
+	return context.WithValue(ctx, mapSettingsKey{}, settings)
+}
+
+func getMapSettings(ctx context.Context) mapSettings {
+	if value := ctx.Value(mapSettingsKey{}); value != nil {
+		return value.(mapSettings)
+	}
+	return mapSettings{}
+}
+
+func withAddressable(ctx context.Context, addressable bool) context.Context {
+	return context.WithValue(ctx, addressableKey{}, addressable)
+}
+
+func isAddressable(ctx context.Context) bool {
+	if value := ctx.Value(addressableKey{}); value != nil {
+		return value.(bool)
+	}
+	return false
+}
+
+// withInput marks types that are converted from JS to Go rather than mapped from Go to JS
+func withInput(ctx context.Context) context.Context {
+	return context.WithValue(ctx, inputKey{}, true)
+}
+
+func isInput(ctx context.Context) bool {
+	return ctx.Value(inputKey{}) != nil
+}
+
+// withAliasBody marks the named type whose alias is being written, so it is rendered inline once
+func withAliasBody(ctx context.Context, typeDef reflect.Type) context.Context {
+	return context.WithValue(ctx, aliasBodyKey{}, typeDef)
+}
+
+func isAliasBody(ctx context.Context, typeDef reflect.Type) bool {
+	value, _ := ctx.Value(aliasBodyKey{}).(reflect.Type)
+	return value == typeDef
+}
+
+func withEnumStyle(ctx context.Context, style EnumStyle) context.Context {
+	return context.WithValue(ctx, enumStyleKey{}, style)
+}
+
+func getEnumStyle(ctx context.Context) EnumStyle {
+	style, _ := ctx.Value(enumStyleKey{}).(EnumStyle)
+	return style
+}
+
+// withAsyncCallback marks callbacks passed to promise functions, which may return a promise Go awaits
+func withAsyncCallback(ctx context.Context, async bool) context.Context {
+	return context.WithValue(ctx, asyncKey{}, async)
+}
+
+func isAsyncCallback(ctx context.Context) bool {
+	async, _ := ctx.Value(asyncKey{}).(bool)
+	return async
+}
@@ -0,0 +1,336 @@
+package crystalline
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Directives are the crystalline:* annotations in the doc comment of a function, method, type or field
+type Directives struct {
+	// Promise makes a function return a Promise
+	Promise bool
+
+	// Ignore hides the function, method, type or field from JS
+	Ignore bool
+
+	// Throws makes a function throw its trailing error instead of returning it
+	Throws bool
+
+	// StrictArgs makes a function reject arguments that do not match their Go types,
+	// or a type reject values assigned to the fields of its live structs
+	StrictArgs bool
+
+	// Expose marks a function for the crystalline-expose generator
+	Expose bool
+
+	// Implement makes the crystalline-expose generator implement an interface with JS objects
+	Implement bool
+
+	// Deprecated marks the declaration as deprecated in the typings, with an optional note
+	Deprecated      bool
+	DeprecationNote string
+
+	// Name replaces the Go name on the JS side
+	Name string
+
+	// Enum emits the constants of a type as a union or enum, Strict also validates values from JS
+	Enum   bool
+	Strict bool
+}
+
+var jsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// parseDirectives reads every comment line starting with crystalline: in the provided doc comments
+func parseDirectives(docs ...*ast.CommentGroup) (Directives, error) {
+	var directives Directives
+
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+
+		for _, comment := range doc.List {
+			text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+			if !strings.HasPrefix(text, "crystalline:") {
+				continue
+			}
+
+			fields := strings.Fields(strings.TrimPrefix(text, "crystalline:"))
+			if len(fields) == 0 {
+				return directives, fmt.Errorf("empty directive: %s", comment.Text)
+			}
+
+			key, value, _ := strings.Cut(fields[0], "=")
+			args := fields[1:]
+
+			switch key {
+			case "promise":
+				directives.Promise = true
+			case "ignore":
+				directives.Ignore = true
+			case "throws":
+				directives.Throws = true
+			case "strict":
+				directives.StrictArgs = true
+			case "expose":
+				directives.Expose = true
+			case "implement":
+				directives.Implement = true
+			case "deprecated":
+				directives.Deprecated = true
+				directives.DeprecationNote = strings.TrimSpace(value + " " + strings.Join(args, " "))
+			case "name":
+				if !jsIdentifier.MatchString(value) || jsReserved[value] {
+					return directives, fmt.Errorf("invalid name in directive: %s", comment.Text)
+				}
+				directives.Name = value
+			case "enum":
+				directives.Enum = true
+				for _, arg := range args {
+					if arg != "strict" {
+						return directives, fmt.Errorf("unknown enum option %q: %s", arg, comment.Text)
+					}
+					directives.Strict = true
+				}
+			default:
+				return directives, fmt.Errorf("unknown directive crystalline:%s", key)
+			}
+		}
+	}
+
+	return directives, nil
+}
+
+// jsName returns the name a declaration is exposed under
+func (d Directives) jsName(goName string) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return goName
+}
+
+// deprecation returns the JSDoc comment of a deprecated declaration, or an empty string
+func (d Directives) deprecation() string {
+	if !d.Deprecated {
+		return ""
+	}
+
+	if d.DeprecationNote == "" {
+		return "/** @deprecated */"
+	}
+
+	return "/** @deprecated " + d.DeprecationNote + " */"
+}
+
+var (
+	funcDirectivesCache = make(map[uintptr]Directives)
+	funcDirectivesMutex sync.RWMutex
+)
+
+// funcDirectives returns the directives of a function, which are empty if its source is not available
+func funcDirectives(pointer uintptr) (Directives, error) {
+	funcDirectivesMutex.RLock()
+	directives, ok := funcDirectivesCache[pointer]
+	funcDirectivesMutex.RUnlock()
+
+	if ok {
+		return directives, nil
+	}
+
+	if fn := findFunction(pointer); fn != nil {
+		var err error
+		directives, err = parseDirectives(fn.Doc)
+		if err != nil {
+			return directives, fmt.Errorf("%s: %w", fn.Name.Name, err)
+		}
+	}
+
+	funcDirectivesMutex.Lock()
+	funcDirectivesCache[pointer] = directives
+	funcDirectivesMutex.Unlock()
+
+	return directives, nil
+}
+
+// methodDirectives returns the directives of a method of a struct type,
+// merged with the MarkIgnored and MarkPromise registries.
+func methodDirectives(typeDef reflect.Type, name string, options *Options) (Directives, error) {
+	// Methods with value receivers are only found in source through the value type
+	method, ok := typeDef.MethodByName(name)
+	if !ok {
+		method, ok = reflect.PointerTo(typeDef).MethodByName(name)
+	}
+
+	var directives Directives
+	if ok {
+		var err error
+		directives, err = funcDirectives(method.Func.Pointer())
+		if err != nil {
+			return directives, err
+		}
+	}
+
+	if options.isIgnored(typeDef.String(), name) || promotedFromHandle(typeDef, name) {
+		directives.Ignore = true
+	}
+
+	if options.isPromise(typeDef.String(), name) {
+		directives.Promise = true
+	}
+
+	return directives, nil
+}
+
+// promotedFromHandle reports whether a method comes from an embedded handle, whose JS value is not a Go API
+func promotedFromHandle(typeDef reflect.Type, name string) bool {
+	if typeDef.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < typeDef.NumField(); i++ {
+		field := typeDef.Field(i)
+		if !field.Anonymous || !isHandle(field.Type) {
+			continue
+		}
+
+		if _, ok := reflect.PointerTo(field.Type).MethodByName(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeDirectives returns the directives of a named type
+func typeDirectives(typeDef reflect.Type) (Directives, error) {
+	genDecl, typeSpec := findTypeSpec(typeDef)
+	if typeSpec == nil {
+		return Directives{}, nil
+	}
+
+	directives, err := parseDirectives(genDecl.Doc, typeSpec.Doc)
+	if err != nil {
+		return directives, fmt.Errorf("%s: %w", typeDef.String(), err)
+	}
+
+	return directives, nil
+}
+
+// fieldDirectives returns the directives of a struct field
+func fieldDirectives(typeDef reflect.Type, field reflect.StructField) (Directives, error) {
+	_, typeSpec := findTypeSpec(typeDef)
+	if typeSpec == nil {
+		return Directives{}, nil
+	}
+
+	structType, ok := typeSpec.Type.(*ast.StructType)
+	if !ok {
+		return Directives{}, nil
+	}
+
+	for _, astField := range structType.Fields.List {
+		if !astFieldHasName(astField, field.Name) {
+			continue
+		}
+
+		directives, err := parseDirectives(astField.Doc, astField.Comment)
+		if err != nil {
+			return directives, fmt.Errorf("%s.%s: %w", typeDef.String(), field.Name, err)
+		}
+
+		return directives, nil
+	}
+
+	return Directives{}, nil
+}
+
+func astFieldHasName(field *ast.Field, name string) bool {
+	for _, fieldName := range field.Names {
+		if fieldName.Name == name {
+			return true
+		}
+	}
+
+	if len(field.Names) > 0 {
+		return false
+	}
+
+	// Embedded fields are named after their type
+	typeExpr := field.Type
+	if star, ok := typeExpr.(*ast.StarExpr); ok {
+		typeExpr = star.X
+	}
+
+	switch castExpr := typeExpr.(type) {
+	case *ast.Ident:
+		return castExpr.Name == name
+	case *ast.SelectorExpr:
+		return castExpr.Sel.Name == name
+	case *ast.IndexExpr:
+		return astFieldHasName(&ast.Field{Type: castExpr.X}, name)
+	case *ast.IndexListExpr:
+		return astFieldHasName(&ast.Field{Type: castExpr.X}, name)
+	}
+
+	return false
+}
+
+// structFields are the exposed fields of a struct type, cached as they are needed on every mapping
+type structFields struct {
+	indices []int
+	names   []string
+	err     error
+}
+
+var (
+	exposedFieldsCache = make(map[reflect.Type]structFields)
+	exposedFieldsMutex sync.RWMutex
+)
+
+// exposedFields returns the exported fields of a struct that are not ignored, with the names they are exposed under.
+// The returned slices are shared and must not be modified.
+func exposedFields(typeDef reflect.Type) ([]int, []string, error) {
+	exposedFieldsMutex.RLock()
+	fields, ok := exposedFieldsCache[typeDef]
+	exposedFieldsMutex.RUnlock()
+
+	if !ok {
+		fields.indices, fields.names, fields.err = findExposedFields(typeDef)
+
+		exposedFieldsMutex.Lock()
+		exposedFieldsCache[typeDef] = fields
+		exposedFieldsMutex.Unlock()
+	}
+
+	return fields.indices, fields.names, fields.err
+}
+
+func findExposedFields(typeDef reflect.Type) ([]int, []string, error) {
+	indices := make([]int, 0)
+	names := make([]string, 0)
+
+	for i := 0; i < typeDef.NumField(); i++ {
+		field := typeDef.Field(i)
+		if field.PkgPath != "" || (field.Anonymous && field.Type == observableType) {
+			continue
+		}
+
+		directives, err := fieldDirectives(typeDef, field)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if directives.Ignore {
+			continue
+		}
+
+		indices = append(indices, i)
+		names = append(names, directives.jsName(field.Name))
+	}
+
+	return indices, names, nil
+}
@@ -0,0 +1,22 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// Emitter is just a placeholder
+type Emitter[T any] struct {
+	_ emitterMarker
+}
+
+// Emit is just a placeholder
+func (e *Emitter[T]) Emit(_ T) {}
+
+// convertEmitter is just a placeholder
+func convertEmitter(_ reflect.Value, _ mapSettings) interface{} {
+	return nil
+}
+
+func (e *Emitter[T]) payloadType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,135 @@
+//go:build js
+
+package crystalline
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"syscall/js"
+)
+
+// Emitter pushes events to JS listeners. Expose a pointer to it, JS receives an object with on, off and once.
+// The zero value is ready to use and Emit can be called from any goroutine.
+type Emitter[T any] struct {
+	_         emitterMarker
+	mutex     sync.Mutex
+	listeners []emitterListener
+	object    js.Value
+	settings  mapSettings
+}
+
+type emitterListener struct {
+	fn   js.Value
+	once bool
+}
+
+// Emit calls every listener with the payload, converted like any other value mapped to JS
+func (e *Emitter[T]) Emit(payload T) {
+	e.mutex.Lock()
+	listeners := make([]emitterListener, len(e.listeners))
+	copy(listeners, e.listeners)
+
+	kept := e.listeners[:0]
+	for _, listener := range e.listeners {
+		if !listener.once {
+			kept = append(kept, listener)
+		}
+	}
+	e.listeners = kept
+	settings := e.settings
+	e.mutex.Unlock()
+
+	if len(listeners) == 0 {
+		return
+	}
+
+	value, err := mapInternal(reflect.ValueOf(&payload).Elem(), false, false, settings)
+	if err != nil {
+		panic(fmt.Errorf("failed internal mapping: %w", err))
+	}
+
+	for _, listener := range listeners {
+		callListener(listener.fn, value)
+	}
+}
+
+// callListener calls a listener, so one that throws does not prevent the others from being called
+func callListener(fn js.Value, args ...interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("event listener threw", slog.Any("error", err))
+		}
+	}()
+
+	fn.Invoke(args...)
+}
+
+// convertEmitter returns the JS object of an emitter
+func convertEmitter(value reflect.Value, settings mapSettings) interface{} {
+	return value.Interface().(interface {
+		jsObject(settings mapSettings) js.Value
+	}).jsObject(settings)
+}
+
+func (e *Emitter[T]) payloadType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// jsObject returns the object listeners subscribe through, created once per emitter
+func (e *Emitter[T]) jsObject(settings mapSettings) js.Value {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.object.IsUndefined() {
+		return e.object
+	}
+
+	e.settings = settings.nested()
+
+	subscribe := func(once bool) js.Value {
+		return throwing(js.FuncOf(func(_ js.Value, args []js.Value) any {
+			// A panic here would end the Go program, so the mistake is thrown in JS instead
+			if len(args) == 0 || args[0].Type() != js.TypeFunction {
+				reportTypeError("expected a listener function")
+				return nil
+			}
+
+			listener := args[0]
+
+			e.mutex.Lock()
+			e.listeners = append(e.listeners, emitterListener{fn: listener, once: once})
+			e.mutex.Unlock()
+
+			// Unsubscribing is off bound to the listener, so no Go function is left to release
+			return e.object.Get("off").Call("bind", js.Null(), listener)
+		}).Value)
+	}
+
+	e.object = js.Global().Get("Object").New()
+	e.object.Set("off", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) > 0 {
+			e.off(args[0])
+		}
+		return nil
+	}))
+	e.object.Set("on", subscribe(false))
+	e.object.Set("once", subscribe(true))
+
+	return e.object
+}
+
+// off removes every subscription of a listener
+func (e *Emitter[T]) off(listener js.Value) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	kept := e.listeners[:0]
+	for _, existing := range e.listeners {
+		if !existing.fn.Equal(listener) {
+			kept = append(kept, existing)
+		}
+	}
+	e.listeners = kept
+}
@@ -0,0 +1,137 @@
+package crystalline
+
+import (
+	"fmt"
+	"go/constant"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EnumStyle controls how named types marked with crystalline:enum are emitted
+type EnumStyle int
+
+const (
+	// EnumStyleUnion emits a union of literal types
+	EnumStyleUnion EnumStyle = iota
+
+	// EnumStyleEnum emits a TypeScript enum backed by an object in the JS glue
+	EnumStyleEnum
+)
+
+// EnumValue is a single constant of a named type marked with crystalline:enum
+type EnumValue struct {
+	Name  string
+	Value constant.Value
+}
+
+// enumValues holds the values JS may pass for types validated as enums
+var (
+	enumValues = make(map[reflect.Type]map[interface{}]bool)
+	enumMutex  sync.RWMutex
+)
+
+// MarkEnum restricts the values converted from JS to the provided ones, for each of their types.
+// Types marked with crystalline:enum strict are registered when exposed, if their source is available.
+func MarkEnum(values ...interface{}) {
+	enumMutex.Lock()
+	defer enumMutex.Unlock()
+
+	for _, value := range values {
+		typeDef := reflect.TypeOf(value)
+		if _, ok := enumValues[typeDef]; !ok {
+			enumValues[typeDef] = make(map[interface{}]bool)
+		}
+		enumValues[typeDef][value] = true
+	}
+}
+
+func registerEnum(typeDef reflect.Type, values []EnumValue) {
+	for _, value := range values {
+		if goValue, ok := enumGoValue(typeDef, value.Value); ok {
+			MarkEnum(goValue.Interface())
+		}
+	}
+}
+
+func validateEnum(value reflect.Value) error {
+	enumMutex.RLock()
+	defer enumMutex.RUnlock()
+
+	allowed, ok := enumValues[value.Type()]
+	if !ok || allowed[value.Interface()] {
+		return nil
+	}
+
+	options := make([]string, 0, len(allowed))
+	for option := range allowed {
+		options = append(options, fmt.Sprint(option))
+	}
+
+	return fmt.Errorf("invalid value %v for %s, expected one of: %s", value.Interface(), value.Type().String(), strings.Join(options, ", "))
+}
+
+func isEnum(typeDef reflect.Type) bool {
+	enumMutex.RLock()
+	defer enumMutex.RUnlock()
+
+	_, ok := enumValues[typeDef]
+	return ok
+}
+
+func enumGoValue(typeDef reflect.Type, value constant.Value) (reflect.Value, bool) {
+	out := reflect.New(typeDef).Elem()
+
+	switch typeDef.Kind() {
+	case reflect.String:
+		if value.Kind() != constant.String {
+			return out, false
+		}
+		out.SetString(constant.StringVal(value))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		converted, ok := constant.Int64Val(constant.ToInt(value))
+		if !ok {
+			return out, false
+		}
+		out.SetInt(converted)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		converted, ok := constant.Uint64Val(constant.ToInt(value))
+		if !ok {
+			return out, false
+		}
+		out.SetUint(converted)
+	case reflect.Float32, reflect.Float64:
+		converted, _ := constant.Float64Val(constant.ToFloat(value))
+		out.SetFloat(converted)
+	case reflect.Bool:
+		if value.Kind() != constant.Bool {
+			return out, false
+		}
+		out.SetBool(constant.BoolVal(value))
+	default:
+		return out, false
+	}
+
+	return out, true
+}
+
+func enumLiteral(value constant.Value) string {
+	switch value.Kind() {
+	case constant.String:
+		return jsString(constant.StringVal(value))
+	case constant.Float:
+		converted, _ := constant.Float64Val(value)
+		return strconv.FormatFloat(converted, 'g', -1, 64)
+	}
+	return value.ExactString()
+}
+
+// hasAlias reports whether a type is written to the typings as a named alias.
+// Generic instantiations are always written inline, as they share a single name.
+func hasAlias(typeDef reflect.Type) bool {
+	if typeDef.Name() == "" || typeDef.PkgPath() == "" || strings.Contains(typeDef.Name(), "[") {
+		return false
+	}
+	return typeDef.Kind() != reflect.Struct && typeDef.Kind() != reflect.Interface
+}
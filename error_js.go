@@ -6,13 +6,41 @@ import (
 	"syscall/js"
 )
 
-var errorConstructor js.Value
+var (
+	errorConstructor     js.Value
+	typeErrorConstructor js.Value
+)
 
 func init() {
 	errorConstructor = js.Global().Get("Error")
+	typeErrorConstructor = js.Global().Get("TypeError")
+}
+
+// reportTypeError reports a misused Go function to JS, which throws it once the function is wrapped by throwing
+func reportTypeError(message string) {
+	js.Global().Set("goInternalError", typeErrorConstructor.New(message))
 }
 
 // convertError is just a placeholder
 func convertError(value error) (interface{}, error) {
 	return errorConstructor.New(value.Error()), nil
 }
+
+// newJSError wraps a thrown or rejected JS value, reading the fields of Error like objects
+func newJSError(value js.Value) *JSError {
+	jsErr := &JSError{value: value}
+
+	if value.Type() == js.TypeObject && value.Get("message").Type() == js.TypeString {
+		jsErr.Message = value.Get("message").String()
+		if name := value.Get("name"); name.Type() == js.TypeString {
+			jsErr.Name = name.String()
+		}
+		if stack := value.Get("stack"); stack.Type() == js.TypeString {
+			jsErr.Stack = stack.String()
+		}
+		return jsErr
+	}
+
+	jsErr.Message = js.Global().Get("String").Invoke(value).String()
+	return jsErr
+}
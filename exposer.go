@@ -4,22 +4,48 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go/ast"
 	"path"
 	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 type Exposer struct {
 	appName        string
 	rootDefinition *Definition
+	options        *Options
+	mutex          sync.Mutex
 }
 
-func NewExposer(appName string) *Exposer {
+var (
+	// exposedApps are the app names of the exposers of this binary, which Ready resolves
+	exposedApps      = make(map[string]bool)
+	exposedAppsMutex sync.Mutex
+)
+
+// NewExposer creates an exposer, the deprecated globals are used as defaults for the options.
+// An exposer is safe for concurrent use.
+func NewExposer(appName string, opts ...Option) *Exposer {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.WasmPath == "" {
+		options.WasmPath = "./" + appName + ".wasm"
+	}
+
+	exposedAppsMutex.Lock()
+	exposedApps[appName] = true
+	exposedAppsMutex.Unlock()
+
 	return &Exposer{
 		appName:        appName,
 		rootDefinition: &Definition{},
+		options:        options,
 	}
 }
 
@@ -40,6 +66,14 @@ func (e *Exposer) ExposeFunc(entity any) error {
 }
 
 func (e *Exposer) ExposeFuncPromise(entity any, promise bool) error {
+	return e.ExposeFuncIn(entity, "", promise)
+}
+
+// ExposeFuncIn exposes a function in a dotted namespace such as "api.v2.users", or in its package if empty
+func (e *Exposer) ExposeFuncIn(entity any, namespace string, promise bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	value := reflect.ValueOf(entity)
 	valueType := value.Type()
 
@@ -48,7 +82,6 @@ func (e *Exposer) ExposeFuncPromise(entity any, promise bool) error {
 	}
 
 	pointer := value.Pointer()
-	e.processFunctionMeta(pointer, "")
 
 	splitDef := strings.Split(path.Base(runtime.FuncForPC(pointer).Name()), ".")
 	pkgName := splitDef[0]
@@ -58,8 +91,85 @@ func (e *Exposer) ExposeFuncPromise(entity any, promise bool) error {
 		return errors.New("could not determine function name or package")
 	}
 
-	setNamespace(e.appName, pkgName, valueName, MapOrPanicPromise(entity, promise))
-	return e.AddEntity([]string{pkgName}, valueName, valueType, promise)
+	if namespace == "" {
+		namespace = pkgName
+	}
+
+	directives, err := funcDirectives(pointer)
+	if err != nil {
+		return err
+	}
+
+	if directives.Ignore {
+		return nil
+	}
+
+	directives.Promise = directives.Promise || promise
+	return e.exposeFunc(value, pointer, namespace, directives.jsName(valueName), directives)
+}
+
+// ExposeValueMethods exposes every exported method of a value as functions of the namespace
+func (e *Exposer) ExposeValueMethods(value any, namespace string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	reflectValue := reflect.ValueOf(value)
+	if reflectValue.Kind() != reflect.Pointer {
+		// Copy into a pointer so methods with pointer receivers are included
+		pointer := reflect.New(reflectValue.Type())
+		pointer.Elem().Set(reflectValue)
+		reflectValue = pointer
+	}
+
+	if reflectValue.IsNil() {
+		return errors.New("cannot expose methods of a nil value")
+	}
+
+	typeDef := reflectValue.Elem().Type()
+
+	for i := 0; i < reflectValue.NumMethod(); i++ {
+		method := reflectValue.Type().Method(i)
+		if method.PkgPath != "" {
+			continue
+		}
+
+		directives, err := methodDirectives(typeDef, method.Name, e.options)
+		if err != nil {
+			return err
+		}
+
+		if directives.Ignore {
+			continue
+		}
+
+		// Methods with value receivers are only found in source through the value type
+		pointer := method.Func.Pointer()
+		if valueMethod, ok := typeDef.MethodByName(method.Name); ok {
+			pointer = valueMethod.Func.Pointer()
+		}
+
+		if err := e.exposeFunc(reflectValue.Method(i), pointer, namespace, directives.jsName(method.Name), directives); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Exposer) exposeFunc(value reflect.Value, pointer uintptr, namespace string, name string, directives Directives) error {
+	e.processFunctionMeta(namespacePath(namespace), pointer, "", name, directives)
+
+	settings := e.mapSettings()
+	settings.throws = directives.Throws
+	settings.strict = directives.StrictArgs
+
+	result, err := mapInternal(value, directives.Promise, false, settings)
+	if err != nil {
+		return fmt.Errorf("failed internal mapping: %w", err)
+	}
+
+	setNamespace(e.appName, namespace, name, result)
+	return e.addEntity(namespacePath(namespace), name, value.Type(), directives.Promise)
 }
 
 func (e *Exposer) ExposeOrPanic(entity any, packageName string, name string) {
@@ -69,13 +179,107 @@ func (e *Exposer) ExposeOrPanic(entity any, packageName string, name string) {
 }
 
 func (e *Exposer) Expose(entity any, packageName string, name string) error {
-	setNamespace(e.appName, packageName, name, MapOrPanic(entity))
-	return e.AddEntity([]string{packageName}, name, reflect.ValueOf(entity).Type(), false)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	setNamespace(e.appName, packageName, name, e.mapOrPanic(entity, false))
+	return e.addEntity(namespacePath(packageName), name, reflect.ValueOf(entity).Type(), false)
+}
+
+// namespacePath splits a dotted namespace, an empty one exposes at the root
+func namespacePath(namespace string) []string {
+	if namespace == "" {
+		return []string{}
+	}
+	return strings.Split(namespace, ".")
+}
+
+// ExposeConst exposes a basic value under its literal type, e.g. const MaxSize: 1024
+func (e *Exposer) ExposeConst(entity any, packageName string, name string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	literal, ok := tsLiteral(reflect.ValueOf(entity))
+	if !ok {
+		return fmt.Errorf("only strings, numbers and booleans can be exposed as constants, got %T", entity)
+	}
+
+	setNamespace(e.appName, packageName, name, e.mapOrPanic(entity, false))
+	if err := e.addEntity(namespacePath(packageName), name, reflect.TypeOf(entity), false); err != nil {
+		return err
+	}
+
+	layer := e.ensureNamespaceExists(namespacePath(packageName))
+	if layer.Consts == nil {
+		layer.Consts = make(map[string]string)
+	}
+
+	layer.Consts[name] = literal
+	return nil
+}
+
+// ExposeVar exposes the variable a pointer points to through a getter, so JS always reads its current value
+func (e *Exposer) ExposeVar(pointer any, packageName string, name string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	value := reflect.ValueOf(pointer)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return errors.New("can only expose variables through a non-nil pointer")
+	}
+
+	// Root entities are exported bindings, which cannot be getters
+	if packageName == "" {
+		return errors.New("variables can only be exposed in a namespace")
+	}
+
+	// The getter returns the pointer, so structs and collections are mapped live like the typings say
+	getterType := reflect.FuncOf(nil, []reflect.Type{value.Type()}, false)
+	getter := reflect.MakeFunc(getterType, func([]reflect.Value) []reflect.Value {
+		return []reflect.Value{value}
+	})
+
+	setNamespace(e.appName, packageName, name, e.mapOrPanic(getter.Interface(), false))
+	if err := e.addEntity(namespacePath(packageName), name, value.Type().Elem(), false); err != nil {
+		return err
+	}
+
+	layer := e.ensureNamespaceExists(namespacePath(packageName))
+	if layer.Getters == nil {
+		layer.Getters = make(map[string]bool)
+	}
+
+	layer.Getters[name] = true
+	return nil
+}
+
+func (e *Exposer) mapOrPanic(entity any, promise bool) interface{} {
+	result, err := mapInternal(reflect.ValueOf(entity), promise, false, e.mapSettings())
+	if err != nil {
+		panic(fmt.Errorf("failed internal mapping: %w", err))
+	}
+	return result
+}
+
+func (e *Exposer) mapSettings() mapSettings {
+	return mapSettings{
+		defaultMode: e.options.StructMode,
+		defaultView: e.options.TypedArrayViews,
+		nilMode:     e.options.NilMode,
+		options:     e.options,
+	}
 }
 
 var namespaceCleaner = regexp.MustCompile(`(\W)`)
 
 func (e *Exposer) AddEntity(namespace []string, name string, typeDef reflect.Type, promise bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.addEntity(namespace, name, typeDef, promise)
+}
+
+func (e *Exposer) addEntity(namespace []string, name string, typeDef reflect.Type, promise bool) error {
 	layer := e.ensureNamespaceExists(namespace)
 
 	if layer.Entities == nil {
@@ -96,18 +300,42 @@ func (e *Exposer) AddEntity(namespace []string, name string, typeDef reflect.Typ
 		layer.Promises[name] = promise
 	}
 
-	e.checkAddDefinition(typeDef)
+	return e.checkAddDefinition(typeDef)
+}
+
+func (e *Exposer) AddDefinition(typeDef reflect.Type) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	added, err := e.addDefinition(typeDef)
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		namespace, name := typeNames(typeDef)
+		return fmt.Errorf("namespace %s already contains definition %s", namespace, name)
+	}
 
 	return nil
 }
 
-func (e *Exposer) AddDefinition(typeDef reflect.Type) error {
-	if typeDef.Kind() != reflect.Struct {
-		return fmt.Errorf("only struct types can be added as definitions")
+// addDefinition registers a struct type and everything it references, returning false if it was already known
+func (e *Exposer) addDefinition(typeDef reflect.Type) (bool, error) {
+	if typeDef.Kind() != reflect.Struct && !isImplemented(typeDef) {
+		return false, fmt.Errorf("only struct types and implemented interfaces can be added as definitions")
 	}
 
-	namespace, nameWithTypes, _ := strings.Cut(typeDef.String(), ".")
-	name, _, _ := strings.Cut(nameWithTypes, "[")
+	directives, err := typeDirectives(typeDef)
+	if err != nil {
+		return false, err
+	}
+
+	if directives.Ignore {
+		return true, nil
+	}
+
+	namespace, name := typeNames(typeDef)
 
 	layer := e.ensureNamespaceExists([]string{namespace})
 
@@ -116,86 +344,202 @@ func (e *Exposer) AddDefinition(typeDef reflect.Type) error {
 	}
 
 	if _, ok := layer.Definitions[name]; ok {
-		return fmt.Errorf("namespace %s already contains definition %s", namespace, name)
+		return false, nil
 	}
 
 	layer.Definitions[name] = typeDef
 
-	for i := 0; i < typeDef.NumField(); i++ {
-		field := typeDef.Field(i)
-		if field.PkgPath != "" {
-			continue
+	if typeDef.Kind() == reflect.Interface {
+		if layer.FuncMeta == nil {
+			layer.FuncMeta = make(map[string]map[string]*FuncMeta)
 		}
+		layer.FuncMeta[name] = make(map[string]*FuncMeta)
 
-		if value, ok := field.Tag.Lookup("crystalline"); ok {
-			if strings.Contains(value, "not_nil") {
-				if layer.NotNil == nil {
-					layer.NotNil = make(map[string]bool)
-				}
+		methods := findInterfaceMethods(typeDef)
+		for i := 0; i < typeDef.NumMethod(); i++ {
+			method := typeDef.Method(i)
+			if err := e.checkAddDefinition(method.Type); err != nil {
+				return false, err
+			}
 
-				layer.NotNil[field.Name] = true
+			if funcType, ok := methods[method.Name]; ok {
+				layer.FuncMeta[name][method.Name] = &FuncMeta{ArgNames: paramNames(funcType)}
 			}
 		}
-		e.checkAddDefinition(field.Type)
+		return true, nil
 	}
 
-	for i := 0; i < typeDef.NumMethod(); i++ {
-		method := typeDef.Method(i)
-		if method.PkgPath != "" {
-			continue
-		}
+	fields, _, err := exposedFields(typeDef)
+	if err != nil {
+		return false, err
+	}
 
-		if inner, ok := ignored[typeDef.String()]; ok {
-			if inner[method.Name] {
-				continue
+	for _, i := range fields {
+		field := typeDef.Field(i)
+
+		if hasTagOption(field, "not_nil") {
+			if layer.NotNil == nil {
+				layer.NotNil = make(map[string]bool)
 			}
+
+			layer.NotNil[field.Name] = true
 		}
 
-		e.checkAddDefinition(method.Type)
-		e.processFunctionMeta(method.Func.Pointer(), name)
+		if err := e.checkAddDefinition(field.Type); err != nil {
+			return false, err
+		}
 	}
 
-	newInstance := reflect.New(typeDef)
-	for i := 0; i < newInstance.NumMethod(); i++ {
-		method := newInstance.Type().Method(i)
-		if method.PkgPath != "" {
-			continue
-		}
+	// Value receivers first, as the pointer method set repeats them through generated wrappers
+	for _, methodSet := range []reflect.Type{typeDef, reflect.PointerTo(typeDef)} {
+		for i := 0; i < methodSet.NumMethod(); i++ {
+			method := methodSet.Method(i)
+			if method.PkgPath != "" {
+				continue
+			}
 
-		if inner, ok := ignored[typeDef.String()]; ok {
-			if inner[method.Name] {
+			methodDirectives, err := methodDirectives(typeDef, method.Name, e.options)
+			if err != nil {
+				return false, err
+			}
+
+			if methodDirectives.Ignore {
 				continue
 			}
+
+			if err := e.checkAddDefinition(method.Type); err != nil {
+				return false, err
+			}
+
+			e.processFunctionMeta([]string{namespace}, method.Func.Pointer(), name, methodDirectives.jsName(method.Name), methodDirectives)
 		}
+	}
 
-		e.checkAddDefinition(method.Type)
-		e.processFunctionMeta(method.Func.Pointer(), name)
+	return true, nil
+}
+
+// typeNames returns the namespace and name a named type is declared under in the typings
+func typeNames(typeDef reflect.Type) (string, string) {
+	namespace, nameWithTypes, _ := strings.Cut(typeDef.String(), ".")
+	name, _, _ := strings.Cut(nameWithTypes, "[")
+
+	if directives, err := typeDirectives(typeDef); err == nil && directives.Name != "" {
+		name = directives.Name
 	}
 
-	return nil
+	return namespace, name
 }
 
-func (e *Exposer) checkAddDefinition(typeDef reflect.Type) {
+// addAlias registers a named non-struct type, returning false if it was already known
+func (e *Exposer) addAlias(typeDef reflect.Type) (bool, error) {
+	directives, err := typeDirectives(typeDef)
+	if err != nil {
+		return false, err
+	}
+
+	namespace, name := typeNames(typeDef)
+
+	layer := e.ensureNamespaceExists([]string{namespace})
+
+	if layer.Aliases == nil {
+		layer.Aliases = make(map[string]reflect.Type)
+	}
+
+	if _, ok := layer.Aliases[name]; ok {
+		return false, nil
+	}
+
+	layer.Aliases[name] = typeDef
+
+	if !directives.Enum {
+		return true, nil
+	}
+
+	values := findEnumValues(typeDef)
+
+	if layer.Enums == nil {
+		layer.Enums = make(map[string][]EnumValue)
+	}
+
+	layer.Enums[name] = values
+
+	if directives.Strict {
+		registerEnum(typeDef, values)
+	}
+
+	return true, nil
+}
+
+func (e *Exposer) checkAddDefinition(typeDef reflect.Type) error {
+	// Handles are typed after their type parameter, they have no definition of their own
+	if isHandle(typeDef) {
+		return nil
+	}
+
+	if payload := emitterPayload(typeDef); payload != nil {
+		return e.checkAddDefinition(payload)
+	}
+
+	if hasAlias(typeDef) {
+		added, err := e.addAlias(typeDef)
+		if err != nil || !added {
+			return err
+		}
+	}
+
 	switch typeDef.Kind() {
 	case reflect.Struct:
-		_ = e.AddDefinition(typeDef)
+		if err := checkValidationTags(typeDef, make(map[reflect.Type]bool)); err != nil {
+			return err
+		}
+		_, err := e.addDefinition(typeDef)
+		return err
+	case reflect.Interface:
+		if isImplemented(typeDef) {
+			_, err := e.addDefinition(typeDef)
+			return err
+		}
 	case reflect.Map:
-		e.checkAddDefinition(typeDef.Key())
+		if err := e.checkAddDefinition(typeDef.Key()); err != nil {
+			return err
+		}
 		fallthrough
 	case reflect.Pointer:
 		fallthrough
 	case reflect.Slice:
 		fallthrough
 	case reflect.Array:
-		e.checkAddDefinition(typeDef.Elem())
+		return e.checkAddDefinition(typeDef.Elem())
 	case reflect.Func:
 		for i := 0; i < typeDef.NumIn(); i++ {
-			e.checkAddDefinition(typeDef.In(i))
+			if err := e.checkAddDefinition(typeDef.In(i)); err != nil {
+				return err
+			}
 		}
 		for i := 0; i < typeDef.NumOut(); i++ {
-			e.checkAddDefinition(typeDef.Out(i))
+			if err := e.checkAddDefinition(typeDef.Out(i)); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
+}
+
+// paramNames returns the names of the parameters of a function, empty for the ones that fall back to argN
+func paramNames(funcType *ast.FuncType) []string {
+	argNames := make([]string, 0)
+	for _, field := range funcType.Params.List {
+		for _, argName := range field.Names {
+			// Blank and reserved names are not valid TypeScript parameters, so they fall back to argN
+			if argName.Name == "_" || jsReserved[argName.Name] {
+				argNames = append(argNames, "")
+			} else {
+				argNames = append(argNames, argName.Name)
+			}
+		}
+	}
+	return argNames
 }
 
 func (e *Exposer) ensureNamespaceExists(namespace []string) *Definition {
@@ -223,46 +567,59 @@ func (e *Exposer) ensureNamespaceExists(namespace []string) *Definition {
 }
 
 func (e *Exposer) Build() (string, string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	var tsdFile strings.Builder
 	var jsFile strings.Builder
 
+	target := e.options.Target
+	if e.options.Worker && target != TargetESM {
+		return "", "", errors.New("worker mode only supports the ESM target")
+	}
+
+	jsFile.WriteString(target.prelude(e.options))
 	jsFile.WriteString(`const wrap = (fn) => {
-  return (...args) => {
-    const result = fn.call(undefined, ...args);
+  return function (...args) {
+    const result = fn.apply(this, args);
     if (globalThis.goInternalError) {
-      const error = new Error(globalThis.goInternalError);
+      const error = globalThis.goInternalError;
       globalThis.goInternalError = undefined;
-      throw error;
+      throw error instanceof Error ? error : new Error(error);
     }
     return result;
-  }
-};`)
+  };
+};
+
+globalThis.goWrap ??= wrap;`)
 	jsFile.WriteString("\n\n")
 
-	defTsdFile, defJsFile, err := e.rootDefinition.Serialize(context.Background(), e.appName, []string{})
+	tsdFile.WriteString("export type Live<T> = T & { readonly __live: true };\n")
+
+	ctx := withEnumStyle(withMapSettings(context.Background(), e.mapSettings()), e.options.EnumStyle)
+	defTsdFile, defJsFile, err := e.rootDefinition.Serialize(ctx, e.appName, []string{})
 	if err != nil {
 		return "", "", err
 	}
 
 	tsdFile.WriteString(defTsdFile)
-	jsFile.WriteString(defJsFile)
+	tsdFile.WriteString(target.typings(e.appName))
 
-	return strings.TrimSpace(tsdFile.String()), strings.TrimSpace(jsFile.String()), nil
-}
+	if e.options.Worker {
+		return strings.TrimSpace(tsdFile.String()), e.rootDefinition.serializeProxy(ctx), nil
+	}
 
-func (e *Exposer) processFunctionMeta(pointer uintptr, interfaceName string) {
-	pc := runtime.FuncForPC(pointer)
+	jsFile.WriteString(defJsFile)
 
-	splitDef := strings.Split(path.Base(pc.Name()), ".")
-	pkgName := splitDef[0]
-	valueName := splitDef[len(splitDef)-1]
+	return strings.TrimSpace(tsdFile.String()), target.wrapModule(e.options, e.appName, strings.TrimSpace(jsFile.String())), nil
+}
 
-	funcDecl := findFunction(pointer)
-	if funcDecl == nil {
-		return
-	}
+// processFunctionMeta records argument names and directives of a function in the namespace it is exposed
+// or declared in, an empty namespace being the root
+func (e *Exposer) processFunctionMeta(namespace []string, pointer uintptr, interfaceName string, name string, directives Directives) {
+	rememberPackageDir(pointer)
 
-	layer := e.ensureNamespaceExists([]string{pkgName})
+	layer := e.ensureNamespaceExists(namespace)
 	if layer.FuncMeta == nil {
 		layer.FuncMeta = make(map[string]map[string]*FuncMeta)
 	}
@@ -272,25 +629,17 @@ func (e *Exposer) processFunctionMeta(pointer uintptr, interfaceName string) {
 	}
 
 	argNames := make([]string, 0)
-	for _, field := range funcDecl.Type.Params.List {
-		for _, name := range field.Names {
-			argNames = append(argNames, name.Name)
-		}
-	}
-
-	promise := false
-	if funcDecl.Doc != nil {
-		for _, comment := range funcDecl.Doc.List {
-			if comment != nil {
-				if strings.Contains(comment.Text, "crystalline:promise") {
-					promise = true
-				}
-			}
-		}
+	if funcDecl := findFunction(pointer); funcDecl != nil {
+		argNames = paramNames(funcDecl.Type)
+	} else if existing, ok := layer.FuncMeta[interfaceName][name]; ok {
+		// Generated pointer receiver wrappers have no source, keep what the value receiver recorded
+		argNames = existing.ArgNames
 	}
 
-	layer.FuncMeta[interfaceName][valueName] = &FuncMeta{
-		ArgNames: argNames,
-		Promise:  promise,
+	layer.FuncMeta[interfaceName][name] = &FuncMeta{
+		ArgNames:    argNames,
+		Promise:     directives.Promise,
+		Throws:      directives.Throws,
+		Deprecation: directives.deprecation(),
 	}
 }
@@ -67,30 +67,20 @@ func TestJSExposer(t *testing.T) {
 	testza.AssertEqual(t, 10, promiseArgs.Int())
 
 	funcResult := js.Global().Get("go").Get(appName).Get("crystalline").Get("FuncFunc").Invoke(js.FuncOf(func(_ js.Value, _ []js.Value) any {
-		return js.Global().Get("Promise").New(js.FuncOf(func(_ js.Value, args []js.Value) any {
-			// args[0] is resolve function
-			go args[0].Invoke("Bob")
-			return nil
-		}))
+		return "Bob"
 	}))
 
-	funcArgs := testResolvePromise(funcResult)
-	testza.AssertEqual(t, js.TypeString, funcArgs.Type())
-	testza.AssertEqual(t, "Hello, Bob", funcArgs.String())
+	testza.AssertEqual(t, js.TypeString, funcResult.Type())
+	testza.AssertEqual(t, "Hello, Bob", funcResult.String())
 
 	sampleBytes := make([]byte, 10_000_000) // ~10 MB
 
 	_, _ = rand.Read(sampleBytes)
 
-	byteFuncResult := js.Global().Get("go").Get(appName).Get("crystalline").Get("ByteFunc").Invoke(js.FuncOf(func(_ js.Value, _ []js.Value) any {
-		return js.Global().Get("Promise").New(js.FuncOf(func(_ js.Value, args []js.Value) any {
-			// args[0] is resolve function
-			go args[0].Invoke(MapOrPanic(sampleBytes))
-			return nil
-		}))
+	byteFuncArgs := js.Global().Get("go").Get(appName).Get("crystalline").Get("ByteFunc").Invoke(js.FuncOf(func(_ js.Value, _ []js.Value) any {
+		return MapOrPanic(sampleBytes)
 	}))
 
-	byteFuncArgs := testResolvePromise(byteFuncResult)
 	testza.AssertEqual(t, js.TypeObject, byteFuncArgs.Type())
 
 	outData := make([]byte, byteFuncArgs.Length())
@@ -114,3 +104,207 @@ func testResolvePromise(promise js.Value) js.Value {
 	close(dataChan)
 	return out
 }
+
+func testRejectPromise(promise js.Value) js.Value {
+	dataChan := make(chan js.Value)
+	promise.Call("catch", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		dataChan <- args[0]
+		return nil
+	}))
+
+	out := <-dataChan
+	close(dataChan)
+	return out
+}
+
+func TestJSExposerVar(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeVar(&Counter, "crystalline", "Counter"))
+
+	getter := js.Global().Get("go").Get("app").Get("crystalline").Get("Counter")
+	testza.AssertEqual(t, 0, getter.Invoke().Int())
+
+	Counter = 5
+	testza.AssertEqual(t, 5, getter.Invoke().Int())
+	Counter = 0
+
+	// Structs are typed Live, so assigning their fields from JS updates the variable
+	testza.AssertNoError(t, e.ExposeVar(&Current, "crystalline", "Current"))
+	current := js.Global().Get("go").Get("app").Get("crystalline").Get("Current").Invoke()
+	testza.AssertTrue(t, current.Get("__live").Bool())
+	current.Set("Value", "changed")
+	testza.AssertEqual(t, "changed", Current.Value)
+	Current.Value = "current"
+}
+
+func TestJSExposerNestedNamespaces(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "api.v2.users", "Count"))
+	testza.AssertNoError(t, e.ExposeFuncIn(SomeFunc, "api.v2", false))
+
+	v2 := js.Global().Get("go").Get("app").Get("api").Get("v2")
+	testza.AssertEqual(t, 10, v2.Get("users").Get("Count").Int())
+	testza.AssertEqual(t, "hello, Bob", v2.Get("SomeFunc").Invoke("Bob", true).Index(0).String())
+}
+
+func TestJSExposerValueMethods(t *testing.T) {
+	service := &Service{}
+
+	e := NewExposer("app", WithIgnored("crystalline.Service", "Hidden"))
+	testza.AssertNoError(t, e.ExposeValueMethods(service, "api.service"))
+
+	ns := js.Global().Get("go").Get("app").Get("api").Get("service")
+	testza.AssertEqual(t, 3, ns.Get("Add").Invoke(1, 2).Int())
+	testza.AssertEqual(t, 1, service.Calls)
+	testza.AssertTrue(t, ns.Get("Hidden").IsUndefined())
+	testza.AssertEqual(t, 1, testResolvePromise(ns.Get("Count").Invoke()).Int())
+}
+
+func TestJSExposerDirectives(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(DirectiveFunc))
+	testza.AssertNoError(t, e.ExposeFunc(IgnoredFunc))
+
+	ns := js.Global().Get("go").Get("app").Get("crystalline")
+	testza.AssertTrue(t, ns.Get("IgnoredFunc").IsUndefined())
+	testza.AssertTrue(t, ns.Get("DirectiveFunc").IsUndefined())
+	testza.AssertEqual(t, 3, ns.Get("parseValue").Invoke("abc").Int())
+
+	thrown := js.Global().Get("eval").Invoke(`(() => {
+	try {
+		go.app.crystalline.parseValue("");
+	} catch (e) {
+		return e.message;
+	}
+})()`)
+	testza.AssertEqual(t, "empty input", thrown.String())
+}
+
+func TestJSReady(t *testing.T) {
+	called := false
+	ready := js.FuncOf(func(this js.Value, args []js.Value) any {
+		called = true
+		return nil
+	})
+	defer ready.Release()
+
+	// Only the apps exposed by this binary are resolved, another binary may load otherApp
+	NewExposer("readyApp")
+	hooks := js.Global().Get("Object").New()
+	hooks.Set("readyApp", ready)
+	hooks.Set("otherApp", ready)
+	js.Global().Set("goReady", hooks)
+	Ready()
+
+	testza.AssertTrue(t, called)
+	testza.AssertTrue(t, hooks.Get("readyApp").IsUndefined())
+	testza.AssertFalse(t, hooks.Get("otherApp").IsUndefined())
+
+	// Without a loader waiting for it, Ready does nothing
+	js.Global().Delete("goReady")
+	Ready()
+}
+
+func TestJSEmitter(t *testing.T) {
+	changes := &Emitter[FileChange]{}
+
+	e := NewExposer("emitterApp")
+	testza.AssertNoError(t, e.Expose(changes, "crystalline", "Changes"))
+
+	js.Global().Get("eval").Invoke(`(() => {
+	const changes = globalThis.go.emitterApp.crystalline.Changes;
+	globalThis.emitterEvents = [];
+	const unsubscribe = changes.on((event) => globalThis.emitterEvents.push("on " + event.Path));
+	changes.once((event) => globalThis.emitterEvents.push("once " + event.Path));
+	const thrower = () => { throw new Error("ignored"); };
+	changes.on(thrower);
+	globalThis.emitterOff = () => {
+		unsubscribe();
+		changes.off(thrower);
+	};
+})()`)
+
+	done := make(chan struct{})
+	go func() {
+		changes.Emit(FileChange{Path: "a.txt"})
+		close(done)
+	}()
+	<-done
+
+	changes.Emit(FileChange{Path: "b.txt", Removed: true})
+	js.Global().Call("emitterOff")
+	changes.Emit(FileChange{Path: "c.txt"})
+
+	events := js.Global().Get("emitterEvents")
+	testza.AssertEqual(t, 3, events.Length())
+	testza.AssertEqual(t, "on a.txt", events.Index(0).String())
+	testza.AssertEqual(t, "once a.txt", events.Index(1).String())
+	testza.AssertEqual(t, "on b.txt", events.Index(2).String())
+
+	thrown := js.Global().Get("eval").Invoke(`(() => {
+	try {
+		globalThis.go.emitterApp.crystalline.Changes.on(undefined);
+	} catch (e) {
+		return e instanceof TypeError ? e.message : "not a TypeError";
+	}
+	return "nothing thrown";
+})()`)
+	testza.AssertEqual(t, "expected a listener function", thrown.String())
+	testza.AssertTrue(t, js.Global().Get("goInternalError").IsUndefined())
+}
+
+func TestJSExposerStrict(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(SignupFunc))
+	testza.AssertNoError(t, e.ExposeFunc(StrictSignupFunc))
+
+	call := func(name string, form string) string {
+		result := js.Global().Get("go").Get("app").Get("crystalline").Get(name).Invoke(js.Global().Get("JSON").Call("parse", form))
+		if thrown := js.Global().Get("goInternalError"); !thrown.IsUndefined() {
+			js.Global().Set("goInternalError", js.Undefined())
+			return thrown.String()
+		}
+		return result.String()
+	}
+
+	// Without strict mode unknown and missing properties are ignored, only validate tags are checked
+	testza.AssertEqual(t, "ann", call("SignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20, "Extra": 1}`))
+	testza.AssertEqual(t, "args[0].Name: length must be at least 2, got 1", call("SignupFunc", `{"Name": "a", "Email": "a@b", "Age": 20}`))
+	testza.AssertEqual(t, "args[0].Email: must match ^[^@,]+@[^@]+$", call("SignupFunc", `{"Name": "ann", "Email": "ann", "Age": 20}`))
+
+	testza.AssertEqual(t, "ann", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20, "Tags": []}`))
+	testza.AssertEqual(t, "args[0].Extra: unknown property", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20, "Tags": [], "Extra": 1}`))
+	testza.AssertEqual(t, "args[0].Tags: is required", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20}`))
+	testza.AssertEqual(t, "args[0].Email: is required", call("StrictSignupFunc", `{"Name": "ann", "Age": 20, "Tags": []}`))
+	testza.AssertEqual(t, "args[0].Age: expected integer, got string", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": "20", "Tags": []}`))
+	testza.AssertEqual(t, "args[0].Age: 300 overflows uint8", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 300, "Tags": []}`))
+	testza.AssertEqual(t, "args[0].Tags[1]: expected string, got number", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20, "Tags": ["a", 1]}`))
+	testza.AssertEqual(t, "args[0].Tags: length must be at most 3, got 4", call("StrictSignupFunc", `{"Name": "ann", "Email": "a@b", "Age": 20, "Tags": ["a", "b", "c", "d"]}`))
+	testza.AssertEqual(t, "args[0]: expected object, got array", call("StrictSignupFunc", `[]`))
+
+	// Methods of objects mapped from Go are not data, so they are not unknown properties
+	withMethod := js.Global().Get("eval").Invoke(`({Name: "ann", Email: "a@b", Age: 20, Tags: [], Summary() {}})`)
+	testza.AssertEqual(t, "ann", js.Global().Get("go").Get("app").Get("crystalline").Get("StrictSignupFunc").Invoke(withMethod).String())
+
+	strict := NewExposer("app", WithStrict(true))
+	testza.AssertNoError(t, strict.ExposeFuncPromise(SignupFunc, true))
+
+	rejected := testRejectPromise(js.Global().Get("go").Get("app").Get("crystalline").Get("SignupFunc").Invoke(js.ValueOf(map[string]any{"Name": "ann"})))
+	testza.AssertEqual(t, "args[0].Email: is required", rejected.Get("message").String())
+}
+
+func TestJSExposerCallbackSettings(t *testing.T) {
+	type Report func(value *int) bool
+
+	callback := js.Global().Get("eval").Invoke(`(value) => value === undefined`)
+	report := func(callback Report) bool {
+		return callback(nil)
+	}
+
+	// Arguments passed to callbacks are mapped with the settings of the exposer the function belongs to
+	undefined := NewExposer("app", WithNilMode(NilAsUndefined))
+	testza.AssertTrue(t, js.ValueOf(undefined.mapOrPanic(report, false)).Invoke(callback).Bool())
+
+	null := NewExposer("app")
+	testza.AssertFalse(t, js.ValueOf(null.mapOrPanic(report, false)).Invoke(callback).Bool())
+}
@@ -1,8 +1,13 @@
 package crystalline
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/MarvinJWendt/testza"
@@ -67,6 +72,61 @@ func ByteFunc(f func() []byte) []byte {
 	return f()
 }
 
+// HTMLCanvasElement names the TS type of canvas handles
+type HTMLCanvasElement struct{}
+
+func HandleFunc(canvas Handle[HTMLCanvasElement], value JSValue) (Handle[HTMLCanvasElement], JSValue) {
+	return canvas, value
+}
+
+// TaggedValue embeds a JSValue next to its own fields, so it is a struct and not a handle
+type TaggedValue struct {
+	ID string
+	JSValue
+}
+
+func TaggedFunc(value TaggedValue) TaggedValue {
+	value.ID += "!"
+	return value
+}
+
+// KeyStore is implemented by JS objects
+type KeyStore interface {
+	Get(key string) (string, error)
+	Set(key string, value string)
+}
+
+// jsKeyStore is what crystalline-expose generates for KeyStore
+type jsKeyStore struct {
+	JSValue
+}
+
+func (adapter jsKeyStore) Get(key string) (string, error) {
+	out := CallMethod[KeyStore](adapter.JSValue, "Get", key)
+	return Out[string](out, 0), Out[error](out, 1)
+}
+
+func (adapter jsKeyStore) Set(key string, value string) {
+	CallMethod[KeyStore](adapter.JSValue, "Set", key, value)
+}
+
+func init() {
+	RegisterInterface(func(object JSValue) KeyStore {
+		return jsKeyStore{object}
+	})
+}
+
+func StoreFunc(store KeyStore, key string) string {
+	value, _ := store.Get(key)
+	store.Set(key, value+"!")
+	return value
+}
+
+func CallbackErrorFunc(f func() (string, error)) string {
+	result, _ := f()
+	return result
+}
+
 var (
 	ExposeArrayTest  = [1]string{"hello"}
 	ExposeSliceTest  = []float64{10}
@@ -127,17 +187,19 @@ func TestExposer(t *testing.T) {
 	testza.AssertNoError(t, err)
 
 	testza.AssertEqual(t, `const wrap = (fn) => {
-  return (...args) => {
-    const result = fn.call(undefined, ...args);
+  return function (...args) {
+    const result = fn.apply(this, args);
     if (globalThis.goInternalError) {
-      const error = new Error(globalThis.goInternalError);
+      const error = globalThis.goInternalError;
       globalThis.goInternalError = undefined;
-      throw error;
+      throw error instanceof Error ? error : new Error(error);
     }
     return result;
-  }
+  };
 };
 
+globalThis.goWrap ??= wrap;
+
 export let GlobalTest;
 export let crystalline;
 
@@ -160,9 +222,31 @@ export const initializeCrystalline = () => {
     PromiseFunc: wrap(globalThis['go']['app']['crystalline']['PromiseFunc']),
     SomeFunc: wrap(globalThis['go']['app']['crystalline']['SomeFunc'])
   };
+};
+
+export const init = async (source) => {
+  const go = new Go();
+
+  let module = source;
+  if (typeof source === 'string' || source instanceof URL) {
+    const response = await fetch(source);
+    module = await response.arrayBuffer();
+  }
+
+  const instance = module instanceof WebAssembly.Module
+    ? await WebAssembly.instantiate(module, go.importObject)
+    : (await WebAssembly.instantiate(module, go.importObject)).instance;
+
+  await new Promise((resolve, reject) => {
+    (globalThis.goReady ??= {})['app'] = resolve;
+    go.run(instance).then(() => reject(new Error('the Go program exited before calling crystalline.Ready()')));
+  });
+
+  initializeCrystalline();
 };`, jsFile)
 
-	testza.AssertEqual(t, `export const GlobalTest = crystalline.GlobalTestObj;
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export const GlobalTest: crystalline.GlobalTestObj;
 export declare namespace crystalline {
   interface GenericStruct {
     FieldOne: string;
@@ -176,36 +260,1106 @@ export declare namespace crystalline {
   }
   interface SomeObj {
     Name: string;
-    Data?: Record<number, number>;
+    Data: Record<number, number> | null;
     Nested: nested.AnotherObj;
     VoidFunc: () => void;
-    MightBeNil?: Array<string>;
+    MightBeNil: Array<string> | null;
     DefinitelyNotNil: Array<string>;
     NotNilMap: Record<string, boolean>;
     NoPointer(first: string, second: number): void;
     Promised(): Promise<void>;
     WithPointer(first: number, second: boolean): void;
   }
-  function ByteFunc(f: () => Promise<(Uint8Array | undefined)>): Promise<(Uint8Array | undefined)>;
-  function ErrorFunc(): Error;
-  const ExposeArrayTest: Array<string> | undefined;
+  function ByteFunc(f: () => (ArrayBuffer | ArrayBufferView | Array<number> | string | null)): (Uint8Array | null);
+  function ErrorFunc(): (Error | null);
+  const ExposeArrayTest: Array<string>;
   const ExposeGenericStruct: crystalline.GenericStruct;
   const ExposeInheritedStructTest: crystalline.InheritedObj;
   const ExposeIntTest: number;
-  const ExposeMapTest: Record<number, number> | undefined;
-  const ExposePointerTest: crystalline.SomeObj | undefined;
-  const ExposeSliceTest: Array<number> | undefined;
+  const ExposeMapTest: Record<number, number> | null;
+  const ExposePointerTest: Live<crystalline.SomeObj> | null;
+  const ExposeSliceTest: Float64Array | null;
   const ExposeStringTest: string;
   const ExposeStructTest: crystalline.SomeObj;
-  function FuncFunc(f: () => Promise<string>): Promise<string>;
-  function InterfaceFunc(): (unknown | undefined);
+  function FuncFunc(f: () => string): string;
+  function InterfaceFunc(): unknown;
   function PromiseFunc(): Promise<number>;
   function SomeFunc(name: string, a: boolean): [string, boolean];
 }
 export declare namespace nested {
   interface AnotherObj {
-    SomeValue?: Array<number>;
+    SomeValue: Array<number> | null;
+  }
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+type ModeItem struct {
+	Value string
+}
+
+type ModeMarked struct {
+	Value string
+}
+
+type ModeObj struct {
+	Auto     ModeItem
+	Live     ModeItem       `crystalline:"live"`
+	Snapshot *ModeItem      `crystalline:"snapshot"`
+	Items    []ModeItem     `crystalline:"live"`
+	Lookup   map[string]int `crystalline:"live"`
+	Marked   ModeMarked
+}
+
+func ModeFunc(item *ModeItem) *ModeItem {
+	return item
+}
+
+func TestExposerStructModes(t *testing.T) {
+	e := NewExposer("app", WithLive("crystalline.ModeMarked"))
+	testza.AssertNoError(t, e.ExposeFunc(ModeFunc))
+	testza.AssertNoError(t, e.Expose(ModeObj{}, "crystalline", "ModeObj"))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface ModeItem {
+    Value: string;
+  }
+  interface ModeMarked {
+    Value: string;
+  }
+  interface ModeObj {
+    Auto: crystalline.ModeItem;
+    Live: Live<crystalline.ModeItem>;
+    Snapshot: crystalline.ModeItem | null;
+    Items: Live<Array<Live<crystalline.ModeItem>>>;
+    Lookup: Live<Record<string, number>>;
+    Marked: Live<crystalline.ModeMarked>;
+  }
+  function ModeFunc(item: crystalline.ModeItem | null): (Live<crystalline.ModeItem> | null);
+  const ModeObj: crystalline.ModeObj;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	e = NewExposer("app", WithStructMode(StructModeSnapshot))
+	testza.AssertNoError(t, e.ExposeFunc(ModeFunc))
+
+	tsdFile, _, err = e.Build()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, tsdFile, "function ModeFunc(item: crystalline.ModeItem | null): (crystalline.ModeItem | null);")
+}
+
+type NilObj struct {
+	Pointer  *ModeItem
+	Required []string `crystalline:"not_nil"`
+	Optional map[string]int
+}
+
+func NilFunc(items []string) error {
+	return nil
+}
+
+func TestExposerNilMode(t *testing.T) {
+	e := NewExposer("app", WithNilMode(NilAsUndefined))
+	testza.AssertNoError(t, e.ExposeFunc(NilFunc))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(NilObj{})))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface ModeItem {
+    Value: string;
+  }
+  interface NilObj {
+    Pointer: Live<crystalline.ModeItem> | undefined;
+    Required: Array<string>;
+    Optional: Record<string, number> | undefined;
+  }
+  function NilFunc(items: Array<string> | undefined): (Error | undefined);
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+// crystalline:enum
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusInactive Status = "inactive"
+)
+
+// crystalline:enum strict
+type Level int
+
+const (
+	LevelLow Level = iota
+	LevelMid
+	LevelHigh
+)
+
+type Labels []string
+
+type EnumObj struct {
+	Status Status
+	Level  Level
+	Labels Labels
+	Lookup map[Status]Level
+}
+
+func EnumFunc(status Status, labels Labels) Level {
+	if status == StatusActive {
+		return LevelHigh
+	}
+	return Level(len(labels))
+}
+
+func TestExposerEnums(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(EnumFunc))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(EnumObj{})))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  type Labels = Array<string>;
+  type Level = 0 | 1 | 2;
+  type Status = "active" | "inactive";
+  interface EnumObj {
+    Status: crystalline.Status;
+    Level: crystalline.Level;
+    Labels: crystalline.Labels | null;
+    Lookup: Record<crystalline.Status, crystalline.Level> | null;
+  }
+  function EnumFunc(status: crystalline.Status, labels: Array<string> | null): crystalline.Level;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	e = NewExposer("app", WithEnumStyle(EnumStyleEnum))
+	testza.AssertNoError(t, e.ExposeFunc(EnumFunc))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, tsdFile, `  enum Level {
+    LevelLow = 0,
+    LevelMid = 1,
+    LevelHigh = 2
+  }
+  enum Status {
+    StatusActive = "active",
+    StatusInactive = "inactive"
+  }`)
+	testza.AssertContains(t, jsFile, `Level: {LevelLow: 0, LevelMid: 1, LevelHigh: 2, '0': 'LevelLow', '1': 'LevelMid', '2': 'LevelHigh'},`)
+	testza.AssertContains(t, jsFile, `Status: {StatusActive: 'active', StatusInactive: 'inactive'},`)
+}
+
+const MaxSize = 1024
+
+var (
+	CurrentStatus = StatusActive
+	Counter       = 0
+	Current       = ModeItem{Value: "current"}
+)
+
+func TestExposerValues(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeConst(MaxSize, "crystalline", "MaxSize"))
+	testza.AssertNoError(t, e.ExposeConst(StatusInactive, "crystalline", "DefaultStatus"))
+	testza.AssertNoError(t, e.ExposeVar(&CurrentStatus, "crystalline", "CurrentStatus"))
+	testza.AssertNoError(t, e.ExposeVar(&Counter, "crystalline", "Counter"))
+	testza.AssertNoError(t, e.ExposeVar(&Current, "crystalline", "Current"))
+
+	testza.AssertNotNil(t, e.ExposeConst(Current, "crystalline", "NotConst"))
+	testza.AssertNotNil(t, e.ExposeVar(Counter, "crystalline", "NotPointer"))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, tsdFile, `  const Counter: number;
+  const Current: Live<crystalline.ModeItem>;
+  const CurrentStatus: crystalline.Status;
+  const DefaultStatus: "inactive";
+  const MaxSize: 1024;`)
+
+	testza.AssertContains(t, jsFile, `    get Counter() { return globalThis['go']['app']['crystalline']['Counter'](); },
+    get Current() { return globalThis['go']['app']['crystalline']['Current'](); },
+    get CurrentStatus() { return globalThis['go']['app']['crystalline']['CurrentStatus'](); },
+    DefaultStatus: globalThis['go']['app']['crystalline']['DefaultStatus'],
+    MaxSize: globalThis['go']['app']['crystalline']['MaxSize']`)
+}
+
+func TestExposerRoot(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "", "RootInt"))
+	testza.AssertNoError(t, e.AddEntity(nil, "RootFunc", reflect.TypeOf(SomeFunc), false))
+	testza.AssertNotNil(t, e.ExposeVar(&Counter, "", "RootCounter"))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, tsdFile, "export function RootFunc(arg1: string, arg2: boolean): [string, boolean];\nexport const RootInt: number;\n")
+	testza.AssertContains(t, jsFile, "export let RootFunc;\nexport let RootInt;\n")
+	testza.AssertContains(t, jsFile, "  RootFunc = wrap(globalThis['go']['app']['RootFunc']);\n  RootInt = globalThis['go']['app']['RootInt'];")
+}
+
+func TestExposerNestedNamespaces(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.Expose(ExposeStringTest, "api", "Version"))
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "api.v2.users", "Count"))
+	testza.AssertNoError(t, e.ExposeFuncIn(SomeFunc, "api.v2", false))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace api {
+  const Version: string;
+  namespace v2 {
+    function SomeFunc(name: string, a: boolean): [string, boolean];
+    namespace users {
+      const Count: number;
+    }
+  }
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	testza.AssertContains(t, jsFile, `export let api;
+
+export const initializeCrystalline = () => {
+  api = {
+    Version: globalThis['go']['app']['api']['Version'],
+    v2: {
+      SomeFunc: wrap(globalThis['go']['app']['api']['v2']['SomeFunc']),
+      users: {
+        Count: globalThis['go']['app']['api']['v2']['users']['Count']
+      }
+    }
+  };
+};`)
+}
+
+type Service struct {
+	Calls int
+}
+
+func (s *Service) Add(a int, b int) int {
+	s.Calls++
+	return a + b
+}
+
+// crystalline:promise
+func (s Service) Count() int {
+	return s.Calls
+}
+
+func (s *Service) Hidden() {
+}
+
+func TestExposerValueMethods(t *testing.T) {
+
+	e := NewExposer("app", WithIgnored("crystalline.Service", "Hidden"))
+	testza.AssertNoError(t, e.ExposeValueMethods(&Service{}, "api.service"))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace api {
+  namespace service {
+    function Add(a: number, b: number): number;
+    function Count(): Promise<number>;
+  }
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+type RootService struct{}
+
+func (RootService) Add(a int, b int) int {
+	return a + b
+}
+
+// crystalline:deprecated use Add instead
+func (RootService) Old(a int) int {
+	return a
+}
+
+func TestExposerRootValueMethods(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeValueMethods(RootService{}, ""))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export function Add(a: number, b: number): number;
+/** @deprecated use Add instead */
+export function Old(a: number): number;
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+func TestExposerNamespacedValueMethods(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeValueMethods(RootService{}, "api.v2"))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace api {
+  namespace v2 {
+    function Add(a: number, b: number): number;
+    /** @deprecated use Add instead */
+    function Old(a: number): number;
   }
 }
-export const initializeCrystalline: () => void;`, tsdFile)
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+func TestGenerateExposeFile(t *testing.T) {
+	source, err := GenerateExposeFile("testdata/expose", "ExposeAll")
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `// Code generated by crystalline-expose. DO NOT EDIT.
+
+package expose
+
+import (
+	"time"
+
+	"github.com/Vilsol/crystalline"
+)
+
+// ExposeAll exposes every function marked with crystalline:expose
+func ExposeAll(e *crystalline.Exposer) {
+	e.ExposeFuncOrPanic(Hello)
+	e.ExposeFuncOrPanicPromise(Slow)
+}
+
+// jsStorage implements Storage with a JS object
+type jsStorage struct {
+	crystalline.JSValue
+}
+
+func (adapter jsStorage) Get(key string) (string, error) {
+	out := crystalline.CallMethod[Storage](adapter.JSValue, "Get", key)
+	return crystalline.Out[string](out, 0), crystalline.Out[error](out, 1)
+}
+
+func (adapter jsStorage) Set(key string, value string) {
+	crystalline.CallMethod[Storage](adapter.JSValue, "Set", key, value)
+}
+
+func (adapter jsStorage) Keys(prefix string, limit ...int) []string {
+	out := crystalline.CallMethod[Storage](adapter.JSValue, "Keys", prefix, limit)
+	return crystalline.Out[[]string](out, 0)
+}
+
+func (adapter jsStorage) Delete(arg1 string) bool {
+	out := crystalline.CallMethod[Storage](adapter.JSValue, "Delete", arg1)
+	return crystalline.Out[bool](out, 0)
+}
+
+func (adapter jsStorage) Expires(key string) time.Duration {
+	out := crystalline.CallMethod[Storage](adapter.JSValue, "Expires", key)
+	return crystalline.Out[time.Duration](out, 0)
+}
+
+func init() {
+	crystalline.RegisterInterface(func(object crystalline.JSValue) Storage {
+		return jsStorage{object}
+	})
+}
+`, string(source))
+}
+
+// crystalline:name=Widget
+// crystalline:deprecated use Gadget instead
+type DirectiveObj struct {
+	// crystalline:name=id
+	ID string
+
+	// crystalline:ignore
+	Secret string
+
+	Visible int // crystalline:deprecated
+}
+
+// crystalline:name=fetch
+// crystalline:throws
+func (d *DirectiveObj) Fetch(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("empty key")
+	}
+	return d.ID + ":" + key, nil
+}
+
+// crystalline:ignore
+func (d DirectiveObj) Internal() {
+}
+
+// crystalline:throws
+// crystalline:name=parseValue
+// crystalline:deprecated
+func DirectiveFunc(input string) (int, error) {
+	if input == "" {
+		return 0, errors.New("empty input")
+	}
+	return len(input), nil
+}
+
+// crystalline:ignore
+func IgnoredFunc() {
+}
+
+// crystalline:unknown
+func UnknownDirectiveFunc() {
+}
+
+func TestSourceCaches(t *testing.T) {
+	indices, names, err := exposedFields(reflect.TypeOf(DirectiveObj{}))
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, []int{0, 2}, indices)
+	testza.AssertEqual(t, []string{"id", "Visible"}, names)
+
+	cachedIndices, _, _ := exposedFields(reflect.TypeOf(DirectiveObj{}))
+	testza.AssertEqual(t, &indices[0], &cachedIndices[0])
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	testza.AssertLen(t, parsePackage(missing, "missing"), 0)
+	_, cached := packageFiles[missing]
+	testza.AssertTrue(t, cached)
+}
+
+func TestExposerDirectives(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(DirectiveFunc))
+	testza.AssertNoError(t, e.ExposeFunc(IgnoredFunc))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(DirectiveObj{})))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  /** @deprecated use Gadget instead */
+  interface Widget {
+    id: string;
+    /** @deprecated */
+    Visible: number;
+    fetch(key: string): string;
+  }
+  /** @deprecated */
+  function parseValue(input: string): number;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	err = NewExposer("app").ExposeFunc(UnknownDirectiveFunc)
+	testza.AssertNotNil(t, err)
+	testza.AssertContains(t, err.Error(), "unknown directive crystalline:unknown")
+}
+
+func TestExposerOptions(t *testing.T) {
+	custom := NewExposer("app",
+		WithQuoteStyle(`"`),
+		WithTrailingComma(true),
+		WithPromise("crystalline.Service", "Add"),
+		WithIgnored("crystalline.Service", "Hidden"),
+	)
+	testza.AssertNoError(t, custom.ExposeValueMethods(&Service{}, "svc"))
+
+	plain := NewExposer("app")
+	testza.AssertNoError(t, plain.ExposeValueMethods(&Service{}, "svc"))
+
+	customTsd, customJs, err := custom.Build()
+	testza.AssertNoError(t, err)
+
+	plainTsd, plainJs, err := plain.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, customTsd, "function Add(a: number, b: number): Promise<number>;")
+	testza.AssertNotContains(t, customTsd, "function Hidden")
+	testza.AssertContains(t, customJs, `Count: wrap(globalThis["go"]["app"]["svc"]["Count"]),`)
+
+	testza.AssertContains(t, plainTsd, "function Add(a: number, b: number): number;")
+	testza.AssertContains(t, plainTsd, "function Hidden(): void;")
+	testza.AssertContains(t, plainJs, `Hidden: wrap(globalThis['go']['app']['svc']['Hidden'])
+`)
+}
+
+type MarkedService struct{}
+
+func (MarkedService) Slow() int {
+	return 0
+}
+
+func (MarkedService) Internal() {
+}
+
+func TestExposerGlobalMarks(t *testing.T) {
+	// The deprecated marks apply to every exposer, including the ones created before them
+	e := NewExposer("app")
+	MarkPromise("crystalline.MarkedService", "Slow")
+	MarkIgnored("crystalline.MarkedService", "Internal")
+	testza.AssertNoError(t, e.ExposeValueMethods(MarkedService{}, "marked"))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, tsdFile, "function Slow(): Promise<number>;")
+	testza.AssertNotContains(t, tsdFile, "function Internal")
+}
+
+func TestExposerConcurrent(t *testing.T) {
+	shared := NewExposer("app")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			namespace := fmt.Sprintf("worker%d", i)
+			testza.AssertNoError(t, shared.ExposeFuncIn(SomeFunc, namespace, false))
+			testza.AssertNoError(t, shared.ExposeValueMethods(&Service{}, namespace+".service"))
+			testza.AssertNoError(t, shared.ExposeConst(MaxSize, namespace, "MaxSize"))
+
+			own := NewExposer("app", WithPromise("crystalline.Service", "Add"), WithStructMode(StructModeSnapshot))
+			testza.AssertNoError(t, own.ExposeValueMethods(&Service{}, "service"))
+			testza.AssertNoError(t, own.AddDefinition(reflect.TypeOf(DirectiveObj{})))
+
+			_, _, err := own.Build()
+			testza.AssertNoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	tsdFile, _, err := shared.Build()
+	testza.AssertNoError(t, err)
+
+	for i := 0; i < 8; i++ {
+		testza.AssertContains(t, tsdFile, fmt.Sprintf("namespace worker%d {", i))
+	}
+}
+
+type TreeNode struct {
+	Name     string
+	Parent   *TreeNode
+	Children []*TreeNode
+	Index    TreeIndex
+}
+
+type TreeIndex map[string]TreeIndex
+
+func TestExposerRecursiveTypes(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(TreeNode{})))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  type TreeIndex = Record<string, crystalline.TreeIndex | null>;
+  interface TreeNode {
+    Name: string;
+    Parent: Live<crystalline.TreeNode> | null;
+    Children: Array<Live<crystalline.TreeNode> | null> | null;
+    Index: crystalline.TreeIndex | null;
+  }
+}`, tsdFile)
+}
+
+func TestExposerCallbacks(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(ByteFunc))
+	testza.AssertNoError(t, e.ExposeFuncPromise(FuncFunc, true))
+	testza.AssertNoError(t, e.ExposeFunc(CallbackErrorFunc))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, tsdFile, "function ByteFunc(f: () => (ArrayBuffer | ArrayBufferView | Array<number> | string | null)): (Uint8Array | null);")
+	testza.AssertContains(t, tsdFile, "function FuncFunc(f: () => string | Promise<string>): Promise<string>;")
+	testza.AssertContains(t, tsdFile, "function CallbackErrorFunc(f: () => string): string;")
+}
+
+func TestExposerHandles(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(HandleFunc))
+	testza.AssertNoError(t, e.ExposeFunc(TaggedFunc))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface TaggedValue {
+    ID: string;
+    JSValue: unknown;
+  }
+  function HandleFunc(canvas: HTMLCanvasElement, value: unknown): [HTMLCanvasElement, unknown];
+  function TaggedFunc(value: crystalline.TaggedValue): crystalline.TaggedValue;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+func TestExposerInterfaces(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.ExposeFunc(StoreFunc))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface KeyStore {
+    Get(key: string): string;
+    Set(key: string, value: string): void;
+  }
+  function StoreFunc(store: crystalline.KeyStore | null, key: string): string;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	testza.AssertNotNil(t, e.AddDefinition(reflect.TypeOf((*fmt.Stringer)(nil)).Elem()))
+}
+
+type FileChange struct {
+	Path    string
+	Removed bool
+}
+
+type ChangeSource struct {
+	*Emitter[FileChange]
+	Name string
+}
+
+func TestExposerEmitters(t *testing.T) {
+	testza.AssertEqual(t, reflect.TypeOf(FileChange{}), emitterPayload(reflect.TypeOf(&Emitter[FileChange]{})))
+	testza.AssertNil(t, emitterPayload(reflect.TypeOf(&ChangeSource{})))
+
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.Expose(&Emitter[FileChange]{}, "crystalline", "Changes"))
+	testza.AssertNoError(t, e.Expose(&Emitter[[]string]{}, "crystalline", "Logs"))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface FileChange {
+    Path: string;
+    Removed: boolean;
+  }
+  const Changes: { on(listener: (event: crystalline.FileChange) => void): () => void; once(listener: (event: crystalline.FileChange) => void): () => void; off(listener: (event: crystalline.FileChange) => void): void };
+  const Logs: { on(listener: (event: Array<string> | null) => void): () => void; once(listener: (event: Array<string> | null) => void): () => void; off(listener: (event: Array<string> | null) => void): void };
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+}
+
+type CounterState struct {
+	Observable
+	Count int
+	Label string
+}
+
+func (c *CounterState) Increment() {
+	c.Count++
+	Notify(c, "Count")
+}
+
+func CounterSnapshot() CounterState {
+	return CounterState{}
+}
+
+func TestExposerObservable(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.Expose(&CounterState{}, "crystalline", "Counter"))
+	testza.AssertNoError(t, e.ExposeFunc(CounterSnapshot))
+
+	tsdFile, _, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export declare namespace crystalline {
+  interface CounterState {
+    Count: number;
+    Label: string;
+    Increment(): void;
+  }
+  const Counter: Live<crystalline.CounterState> & { subscribe(run: (value: Live<crystalline.CounterState>, field?: string) => void): () => void } | null;
+  function CounterSnapshot(): crystalline.CounterState;
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	testza.AssertPanics(t, func() { Notify(CounterState{}, "Count") })
+	testza.AssertPanics(t, func() { Notify(&FileChange{}, "Path") })
+	testza.AssertPanics(t, func() { Notify(&CounterState{}, "Missing") })
+	Notify(&CounterState{}, "Label")
+}
+
+type SchemaObj struct {
+	Small  int8
+	Count  uint
+	Data   []byte
+	Pair   [2]string
+	Tags   []string `crystalline:"not_nil"`
+	Status *Status
+	OnDone func()
+}
+
+func TestExposerSchemas(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(TreeNode{})))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(SchemaObj{})))
+
+	schema, err := e.BuildJSONSchema()
+	testza.AssertNoError(t, err)
+
+	var document struct {
+		Defs map[string]interface{} `json:"$defs"`
+	}
+	testza.AssertNoError(t, json.Unmarshal([]byte(schema), &document))
+	testza.AssertEqual(t, []string{"crystalline.SchemaObj", "crystalline.Status", "crystalline.TreeIndex", "crystalline.TreeNode"}, SortedKeys(document.Defs))
+
+	testza.AssertContains(t, schema, `"crystalline.TreeIndex": {
+      "additionalProperties": {
+        "anyOf": [
+          {
+            "$ref": "#/$defs/crystalline.TreeIndex"
+          },
+          {
+            "type": "null"
+          }
+        ]
+      },
+      "type": "object"
+    }`)
+	testza.AssertContains(t, schema, `"Small": {
+          "maximum": 127,
+          "minimum": -128,
+          "type": "integer"
+        }`)
+	testza.AssertContains(t, schema, `"Tags": {
+          "items": {
+            "type": "string"
+          },
+          "type": "array"
+        }`)
+	// Omitted nullable fields are converted to nil, so only the others are required
+	testza.AssertContains(t, schema, `"required": [
+        "Small",
+        "Count",
+        "Pair",
+        "Tags"
+      ]`)
+	testza.AssertContains(t, schema, `"required": [
+        "Name"
+      ]`)
+	testza.AssertNotContains(t, schema, "OnDone")
+
+	zod, err := e.BuildZod()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `import { z } from 'zod';
+
+const crystalline_Status = z.enum(['active', 'inactive']);
+
+const crystalline_SchemaObj = z.object({
+  Small: z.number().int().min(-128).max(127),
+  Count: z.number().int().min(0),
+  Data: z.union([z.string(), z.array(z.number().int().min(0).max(255))]).nullable().optional(),
+  Pair: z.array(z.string()).length(2),
+  Tags: z.array(z.string()),
+  Status: crystalline_Status.nullable().optional()
+});
+
+const crystalline_TreeIndex: z.ZodTypeAny = z.record(z.string(), z.lazy(() => crystalline_TreeIndex).nullable());
+
+const crystalline_TreeNode: z.ZodTypeAny = z.object({
+  Name: z.string(),
+  Parent: z.lazy(() => crystalline_TreeNode).nullable().optional(),
+  Children: z.array(z.lazy(() => crystalline_TreeNode).nullable()).nullable().optional(),
+  Index: crystalline_TreeIndex.nullable().optional()
+});
+
+export const crystalline = {
+  SchemaObj: crystalline_SchemaObj,
+  Status: crystalline_Status,
+  TreeIndex: crystalline_TreeIndex,
+  TreeNode: crystalline_TreeNode
+};
+`, zod)
+
+	e = NewExposer("app", WithNilMode(NilAsUndefined))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(SchemaObj{})))
+
+	schema, err = e.BuildJSONSchema()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, schema, `"required": [
+        "Small",
+        "Count",
+        "Pair",
+        "Tags"
+      ]`)
+
+	zod, err = e.BuildZod()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, zod, "Status: crystalline_Status.nullish()")
+}
+
+// crystalline:enum
+type Phrase string
+
+const (
+	PhraseIts   Phrase = "it's"
+	PhraseHello Phrase = `say "hi"`
+)
+
+type QuotedObj struct {
+	Phrase Phrase
+	Text   string `validate:"regex=^[^'\"]*$"`
+}
+
+func TestExposerZodQuotes(t *testing.T) {
+	for _, quote := range []string{"'", `"`, "`"} {
+		e := NewExposer("app", WithQuoteStyle(quote))
+		testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(QuotedObj{})))
+
+		zod, err := e.BuildZod()
+		testza.AssertNoError(t, err)
+
+		switch quote {
+		case "'":
+			testza.AssertContains(t, zod, `z.enum(['it\'s', 'say "hi"'])`)
+			testza.AssertContains(t, zod, `new RegExp('^[^\'"]*$')`)
+		case `"`:
+			testza.AssertContains(t, zod, `z.enum(["it's", "say \"hi\""])`)
+			testza.AssertContains(t, zod, `new RegExp("^[^'\"]*$")`)
+		default:
+			testza.AssertContains(t, zod, "z.enum([`it's`, `say \"hi\"`])")
+			testza.AssertContains(t, zod, "new RegExp(`^[^'\"]*\\$`)")
+		}
+	}
+}
+
+type SignupForm struct {
+	Name  string   `validate:"min=2,max=16"`
+	Email string   `validate:"regex=^[^@,]+@[^@]+$"`
+	Age   uint8    `validate:"min=13"`
+	Tags  []string `crystalline:"not_nil" validate:"max=3"`
+}
+
+// crystalline:strict
+func StrictSignupFunc(form SignupForm) string {
+	return form.Name
+}
+
+func SignupFunc(form SignupForm) string {
+	return form.Name
+}
+
+func TestExposerValidationSchemas(t *testing.T) {
+	e := NewExposer("app")
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(SignupForm{})))
+
+	zod, err := e.BuildZod()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, zod, `const crystalline_SignupForm = z.object({
+  Name: z.string().min(2).max(16),
+  Email: z.string().regex(new RegExp('^[^@,]+@[^@]+$')),
+  Age: z.number().int().min(13).max(255),
+  Tags: z.array(z.string()).max(3)
+});`)
+
+	schema, err := e.BuildJSONSchema()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, schema, `"Name": {
+          "maxLength": 16,
+          "minLength": 2,
+          "type": "string"
+        }`)
+	testza.AssertContains(t, schema, `"pattern": "^[^@,]+@[^@]+$"`)
+	testza.AssertContains(t, schema, `"maxItems": 3`)
+}
+
+func TestExposerTargets(t *testing.T) {
+	e := NewExposer("app", WithTarget(TargetCommonJS))
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "", "RootInt"))
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export const RootInt: number;
+export declare namespace crystalline {
+  function SomeFunc(name: string, a: boolean): [string, boolean];
+}
+/** Reads the exposed values into the bindings, init calls it once Go is ready */
+export const initializeCrystalline: () => void;
+/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */
+export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;`, tsdFile)
+
+	testza.AssertContains(t, jsFile, `let RootInt;
+let crystalline;
+
+const initializeCrystalline = () => {
+  RootInt = globalThis['go']['app']['RootInt'];
+  crystalline = {
+    SomeFunc: wrap(globalThis['go']['app']['crystalline']['SomeFunc'])
+  };
+};
+
+const init = async (source) => {`)
+
+	testza.AssertContains(t, jsFile, `module.exports = {
+  get RootInt() { return RootInt; },
+  get crystalline() { return crystalline; },
+  initializeCrystalline,
+  init
+};`)
+
+	e = NewExposer("app", WithTarget(TargetUMD))
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+
+	tsdFile, jsFile, err = e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertTrue(t, strings.HasSuffix(tsdFile, "export as namespace app;"))
+	testza.AssertContains(t, jsFile, "    root['app'] = factory();")
+	testza.AssertContains(t, jsFile, `  return {
+    get crystalline() { return crystalline; },
+    initializeCrystalline,
+    init
+  };
+}));`)
+
+	e = NewExposer("app", WithTarget(TargetNode), WithWasmPath("../bin/app.wasm"))
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+
+	tsdFile, jsFile, err = e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertTrue(t, strings.HasSuffix(tsdFile, "export const ready: Promise<void>;"))
+	testza.AssertContains(t, jsFile, "require('./wasm_exec.js');")
+	testza.AssertContains(t, jsFile, "const ready = init(fs.readFileSync(path.resolve(__dirname, '../bin/app.wasm')));")
+}
+
+func TestExposerQuotedStrings(t *testing.T) {
+	e := NewExposer("o'app", WithTarget(TargetNode), WithWasmPath("it's/app.wasm"), WithEnumStyle(EnumStyleEnum))
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(QuotedObj{})))
+
+	_, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertContains(t, jsFile, `Phrase: {PhraseIts: 'it\'s', PhraseHello: 'say "hi"'}`)
+	testza.AssertContains(t, jsFile, `SomeFunc: wrap(globalThis['go']['o\'app']['crystalline']['SomeFunc'])`)
+	testza.AssertContains(t, jsFile, `path.resolve(__dirname, 'it\'s/app.wasm')`)
+
+	e = NewExposer("o'app", WithTarget(TargetUMD), WithQuoteStyle(`"`))
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+
+	_, jsFile, err = e.Build()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, jsFile, `root["o'app"] = factory();`)
+
+	e = NewExposer("o'app", WithWorker(true))
+	worker, err := e.BuildWorker()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, worker, `const appName = 'o\'app';`)
+}
+
+func TestExposerWorker(t *testing.T) {
+	e := NewExposer("app", WithWorker(true))
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "", "RootInt"))
+	testza.AssertNoError(t, e.ExposeVar(&Counter, "api", "Counter"))
+	testza.AssertNoError(t, e.ExposeFuncIn(SomeFunc, "api", false))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(DirectiveObj{})))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	testza.AssertEqual(t, `export type Live<T> = T & { readonly __live: true };
+export const RootInt: Promise<number>;
+export declare namespace api {
+  const Counter: Promise<number>;
+  function SomeFunc(name: string, a: boolean): Promise<[string, boolean]>;
+}
+export declare namespace crystalline {
+  /** @deprecated use Gadget instead */
+  interface Widget {
+    id: string;
+    /** @deprecated */
+    Visible: number;
+  }
+}
+/** Starts the worker hosting the Go runtime, and resolves once Go called crystalline.Ready() */
+export function init(worker: string | URL | Worker): Promise<void>;`, tsdFile)
+
+	testza.AssertContains(t, jsFile, `export const RootInt = call(['RootInt']);
+export const api = {
+  get Counter() { return call(['api', 'Counter'], []); },
+  SomeFunc: (...args) => call(['api', 'SomeFunc'], args)
+};`)
+
+	workerFile, err := e.BuildWorker()
+	testza.AssertNoError(t, err)
+	testza.AssertContains(t, workerFile, "importScripts('./wasm_exec.js');")
+	testza.AssertContains(t, workerFile, "const response = await fetch('./app.wasm');")
+
+	_, err = NewExposer("app").BuildWorker()
+	testza.AssertNotNil(t, err)
+
+	_, _, err = NewExposer("app", WithWorker(true), WithTarget(TargetCommonJS)).Build()
+	testza.AssertNotNil(t, err)
 }
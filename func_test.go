@@ -3,6 +3,10 @@
 package crystalline
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"syscall/js"
 	"testing"
 	"unsafe"
@@ -21,6 +25,17 @@ func init() {
 }`)
 
 	invoker = js.Global().Get("Invoker")
+
+	// The helper the generated glue publishes, which throwing functions go through
+	js.Global().Get("eval").Invoke(`global.goWrap = (fn) => function (...args) {
+	const result = fn.apply(this, args);
+	if (global.goInternalError) {
+		const error = global.goInternalError;
+		global.goInternalError = undefined;
+		throw error instanceof Error ? error : new Error(error);
+	}
+	return result;
+}`)
 }
 
 func Run(method []interface{}, args ...interface{}) js.Value {
@@ -211,9 +226,8 @@ func TestFnFunc(t *testing.T) {
 		return data == "hello", "bob"
 	}))
 
-	testFuncArgs := testResolvePromise(result)
-	testza.AssertTrue(t, testFuncArgs.Index(0).Bool())
-	testza.AssertEqual(t, "bob", testFuncArgs.Index(1).String())
+	testza.AssertTrue(t, result.Index(0).Bool())
+	testza.AssertEqual(t, "bob", result.Index(1).String())
 
 	type FnSampleFuncOne func(string) bool
 	js.Global().Set("TestFuncOneReturn", MapOrPanic(func(a FnSampleFuncOne) bool {
@@ -224,8 +238,7 @@ func TestFnFunc(t *testing.T) {
 		return data == "hello"
 	}))
 
-	testFuncOneReturnArgs := testResolvePromise(result)
-	testza.AssertTrue(t, testFuncOneReturnArgs.Bool())
+	testza.AssertTrue(t, result.Bool())
 
 	js.Global().Set("TestFuncNoReturn", MapOrPanic(func(a FnSampleFunc) {
 		x, y := a("hello")
@@ -238,6 +251,218 @@ func TestFnFunc(t *testing.T) {
 	}))
 }
 
+func TestFnCallbackReentrancy(t *testing.T) {
+	type FnCallback func(int) int
+
+	js.Global().Set("TestDouble", MapOrPanic(func(x int) int {
+		return x * 2
+	}))
+
+	// The callback calls back into Go while Go is still waiting for it
+	js.Global().Set("TestReentrant", MapOrPanic(func(callback FnCallback) int {
+		return callback(1) + callback(2)
+	}))
+
+	result := js.Global().Get("eval").Invoke(`global.TestReentrant((x) => global.TestDouble(x) + 1)`)
+	testza.AssertEqual(t, 8, result.Int())
+}
+
+func TestFnAsyncCallback(t *testing.T) {
+	type FnAsyncCallback func(string) string
+
+	callback := js.Global().Get("eval").Invoke(`(async (data) => data + "!")`)
+
+	js.Global().Set("TestAsyncCallbackSync", MapOrPanic(func(f FnAsyncCallback) string {
+		return f("sync")
+	}))
+	testza.AssertTrue(t, Run([]interface{}{"TestAsyncCallbackSync"}, callback).IsNull())
+	testza.AssertContains(t, js.Global().Get("goInternalError").String(), "only callbacks passed to functions exposed as promises can be awaited")
+	js.Global().Set("goInternalError", js.Undefined())
+
+	js.Global().Set("TestAsyncCallbackPromise", MapOrPanicPromise(func(f FnAsyncCallback) string {
+		return f("promise")
+	}, true))
+	testza.AssertEqual(t, "promise!", testResolvePromise(Run([]interface{}{"TestAsyncCallbackPromise"}, callback)).String())
+
+	// Callbacks nested in the arguments of promise functions may be awaited too
+	type asyncHolder struct {
+		Callback FnAsyncCallback
+	}
+	js.Global().Set("TestAsyncCallbackNested", MapOrPanicPromise(func(holder asyncHolder) string {
+		return holder.Callback("nested")
+	}, true))
+	holder := js.Global().Get("Object").New()
+	holder.Set("Callback", callback)
+	testza.AssertEqual(t, "nested!", testResolvePromise(Run([]interface{}{"TestAsyncCallbackNested"}, holder)).String())
+
+	// Callbacks of synchronous functions refuse promises even when called later from a goroutine
+	results := make(chan string)
+	js.Global().Set("TestAsyncCallbackGoroutine", MapOrPanic(func(f FnAsyncCallback) {
+		go func() {
+			defer func() {
+				results <- fmt.Sprint(recover())
+			}()
+			f("goroutine")
+		}()
+	}))
+	Run([]interface{}{"TestAsyncCallbackGoroutine"}, callback)
+	testza.AssertContains(t, <-results, "only callbacks passed to functions exposed as promises can be awaited")
+}
+
+func TestFnCallbackErrors(t *testing.T) {
+	type FnErrorCallback func(string) (string, error)
+
+	var callbackErr error
+	js.Global().Set("TestCallbackError", MapOrPanicPromise(func(f FnErrorCallback) string {
+		result, err := f("data")
+		callbackErr = err
+		return result
+	}, true))
+
+	result := testResolvePromise(js.Global().Get("eval").Invoke(`global.TestCallbackError(async (data) => data + "!")`))
+	testza.AssertEqual(t, "data!", result.String())
+	testza.AssertNil(t, callbackErr)
+
+	testResolvePromise(js.Global().Get("eval").Invoke(`global.TestCallbackError(async () => { throw new TypeError("rejected"); })`))
+	var jsErr *JSError
+	testza.AssertTrue(t, errors.As(callbackErr, &jsErr))
+	testza.AssertEqual(t, "TypeError", jsErr.Name)
+	testza.AssertEqual(t, "rejected", jsErr.Message)
+	testza.AssertContains(t, jsErr.Stack, "rejected")
+	testza.AssertEqual(t, "TypeError: rejected", callbackErr.Error())
+
+	testResolvePromise(js.Global().Get("eval").Invoke(`global.TestCallbackError(() => { throw "thrown"; })`))
+	testza.AssertTrue(t, errors.As(callbackErr, &jsErr))
+	testza.AssertEqual(t, "thrown", callbackErr.Error())
+
+	type FnCallback func() string
+
+	js.Global().Set("TestCallbackPropagate", MapOrPanicPromise(func(f FnCallback) string {
+		return f()
+	}, true))
+
+	rejected := testRejectPromise(js.Global().Get("eval").Invoke(`global.TestCallbackPropagate(async () => { throw new RangeError("propagated"); })`))
+	testza.AssertEqual(t, "RangeError", rejected.Get("name").String())
+	testza.AssertEqual(t, "propagated", rejected.Get("message").String())
+}
+
+func TestFnPromiseRejects(t *testing.T) {
+	js.Global().Set("TestPromisePanic", MapOrPanicPromise(func(n int) int {
+		if n < 0 {
+			panic("negative")
+		}
+		return n
+	}, true))
+
+	rejected := testRejectPromise(js.Global().Get("eval").Invoke(`global.TestPromisePanic(-1)`))
+	testza.AssertContains(t, rejected.String(), "Panic: negative")
+	testza.AssertTrue(t, js.Global().Get("goInternalError").IsUndefined())
+
+	rejected = testRejectPromise(js.Global().Get("eval").Invoke(`global.TestPromisePanic("many")`))
+	testza.AssertContains(t, rejected.String(), "failed parsing string to int")
+	testza.AssertTrue(t, js.Global().Get("goInternalError").IsUndefined())
+
+	testza.AssertEqual(t, 2, testResolvePromise(js.Global().Get("eval").Invoke(`global.TestPromisePanic(2)`)).Int())
+}
+
+type FnCanvas struct{}
+
+type FnHandles struct {
+	Canvas Handle[FnCanvas]
+	Raw    js.Value
+}
+
+func TestFnHandles(t *testing.T) {
+	var kept FnHandles
+	js.Global().Set("TestHandles", MapOrPanic(func(canvas Handle[FnCanvas], value JSValue, handles FnHandles) (Handle[FnCanvas], JSValue, js.Value) {
+		kept = handles
+		return canvas, value, handles.Raw
+	}))
+
+	result := js.Global().Get("eval").Invoke(`(() => {
+	const canvas = { draw: () => "drawn" };
+	const value = new Map();
+	const raw = [1];
+	const [outCanvas, outValue, outRaw] = global.TestHandles(canvas, value, { Canvas: canvas, Raw: raw });
+	return outCanvas === canvas && outValue === value && outRaw === raw;
+})()`)
+	testza.AssertTrue(t, result.Bool())
+	testza.AssertEqual(t, "drawn", kept.Canvas.Call("draw").String())
+
+	testza.AssertTrue(t, js.Global().Get("Object").Call("is", MapOrPanic(NewHandle[FnCanvas](kept.Raw)), kept.Raw).Bool())
+
+	// Structs embedding a handle keep their own fields
+	js.Global().Set("TestTagged", MapOrPanic(TaggedFunc))
+	tagged := js.Global().Get("eval").Invoke(`(() => {
+	const value = [1];
+	const out = global.TestTagged({ ID: "a", JSValue: value });
+	return [out.ID, out.JSValue === value];
+})()`)
+	testza.AssertEqual(t, "a!", tagged.Index(0).String())
+	testza.AssertTrue(t, tagged.Index(1).Bool())
+}
+
+func TestFnInterfaceImplementation(t *testing.T) {
+	js.Global().Set("TestStore", MapOrPanic(StoreFunc))
+	js.Global().Set("TestStoreError", MapOrPanic(func(store KeyStore) string {
+		_, err := store.Get("missing")
+		return err.Error()
+	}))
+	js.Global().Set("TestStoreIdentity", MapOrPanic(func(store KeyStore) KeyStore {
+		return store
+	}))
+	js.Global().Set("TestStoreNil", MapOrPanic(func(store KeyStore) bool {
+		return store == nil
+	}))
+
+	result := js.Global().Get("eval").Invoke(`(() => {
+	const data = { a: "1" };
+	const store = {
+		Get(key) {
+			if (!(key in data)) {
+				throw new Error("no " + key);
+			}
+			return data[key];
+		},
+		Set(key, value) {
+			data[key] = value;
+		},
+	};
+	return [
+		global.TestStore(store, "a"),
+		data.a,
+		global.TestStoreError(store),
+		global.TestStoreIdentity(store) === store,
+		global.TestStoreNil(null),
+	];
+})()`)
+
+	testza.AssertEqual(t, "1", result.Index(0).String())
+	testza.AssertEqual(t, "1!", result.Index(1).String())
+	testza.AssertEqual(t, "Error: no missing", result.Index(2).String())
+	testza.AssertTrue(t, result.Index(3).Bool())
+	testza.AssertTrue(t, result.Index(4).Bool())
+
+	// Methods of objects passed to promise functions may return a promise, which is awaited
+	asyncStore := js.Global().Get("eval").Invoke(`({
+	data: { a: "1" },
+	async Get(key) {
+		return this.data[key];
+	},
+	async Set(key, value) {
+		this.data[key] = value;
+	},
+})`)
+
+	js.Global().Set("TestStoreAsync", MapOrPanicPromise(StoreFunc, true))
+	testza.AssertEqual(t, "1", testResolvePromise(Run([]interface{}{"TestStoreAsync"}, asyncStore, "a")).String())
+	testza.AssertEqual(t, "1!", asyncStore.Get("data").Get("a").String())
+
+	testza.AssertTrue(t, Run([]interface{}{"TestStore"}, asyncStore, "a").IsNull())
+	testza.AssertContains(t, js.Global().Get("goInternalError").String(), "only callbacks passed to functions exposed as promises can be awaited")
+	js.Global().Set("goInternalError", js.Undefined())
+}
+
 type FnInterface interface {
 }
 
@@ -345,8 +570,7 @@ func TestFnWrappedType(t *testing.T) {
 
 	js.Global().Set("TestWrappedTypeFunc", MapOrPanic(func(a WrappedTypeFunc) bool { return a() == "hello" }))
 	TestWrappedTypeFuncResult := Run([]interface{}{"TestWrappedTypeFunc"}, MapOrPanic(func() string { return "hello" }))
-	TestWrappedTypeFuncArgs := testResolvePromise(TestWrappedTypeFuncResult)
-	testza.AssertTrue(t, TestWrappedTypeFuncArgs.Bool())
+	testza.AssertTrue(t, TestWrappedTypeFuncResult.Bool())
 
 	js.Global().Set("TestWrappedTypeMap", MapOrPanic(func(a WrappedTypeMap) bool { return a[0] == "hello" }))
 	testza.AssertTrue(t, Run([]interface{}{"TestWrappedTypeMap"}, MapOrPanic(map[int]string{0: "hello"})).Bool())
@@ -372,3 +596,88 @@ func TestFnPointers(t *testing.T) {
 	}))
 	testza.AssertTrue(t, Run([]interface{}{"TestPointersNil"}, nil).Bool())
 }
+
+func TestFnEnum(t *testing.T) {
+	MarkEnum(StatusActive, StatusInactive)
+	js.Global().Set("TestEnum", MapOrPanic(func(status Status) bool {
+		return status == StatusInactive
+	}))
+	testza.AssertTrue(t, Run([]interface{}{"TestEnum"}, "inactive").Bool())
+	Run([]interface{}{"TestEnum"}, "unknown")
+	testza.AssertContains(t, js.Global().Get("goInternalError").String(), "invalid value unknown")
+	js.Global().Set("goInternalError", js.Undefined())
+
+	MarkEnum(LevelLow, LevelMid, LevelHigh)
+	js.Global().Set("TestIntEnum", MapOrPanic(func(level Level) int {
+		return int(level)
+	}))
+	testza.AssertEqual(t, 2, Run([]interface{}{"TestIntEnum"}, 2).Int())
+	Run([]interface{}{"TestIntEnum"}, 5)
+	testza.AssertContains(t, js.Global().Get("goInternalError").String(), "invalid value 5")
+	js.Global().Set("goInternalError", js.Undefined())
+}
+
+type RecursiveNode struct {
+	Value    int
+	Next     *RecursiveNode
+	Children []RecursiveNode
+}
+
+func TestFnRecursive(t *testing.T) {
+	js.Global().Set("TestRecursive", MapOrPanic(func(node RecursiveNode) int {
+		return node.Value + node.Next.Value + node.Next.Next.Value + node.Children[0].Value
+	}))
+
+	node := js.Global().Get("JSON").Call("parse", `{"Value": 1, "Next": {"Value": 2, "Next": {"Value": 3}}, "Children": [{"Value": 4}]}`)
+	testza.AssertEqual(t, 10, Run([]interface{}{"TestRecursive"}, node).Int())
+}
+
+type brokenOuter struct {
+	Inner *brokenInner
+	Code  string `validate:"size=3"`
+}
+
+type brokenInner struct {
+	Outer *brokenOuter
+}
+
+func TestFnBrokenValidation(t *testing.T) {
+	_, err := Map(func(brokenOuter) {})
+	testza.AssertEqual(t, `invalid field brokenOuter.Code: unknown validate option "size=3" on Code`, err.Error())
+
+	// brokenInner was built on the way and refers to brokenOuter, so it must not stay cached
+	_, err = jsToGo(reflect.TypeOf(brokenOuter{}))
+	testza.AssertNotNil(t, err)
+	_, err = jsToGo(reflect.TypeOf(brokenInner{}))
+	testza.AssertNotNil(t, err)
+}
+
+func TestConcurrentConverters(t *testing.T) {
+	type concurrentInner struct {
+		Values []string
+	}
+
+	type concurrentOuter struct {
+		Inner map[string]concurrentInner
+	}
+
+	data := js.Global().Get("JSON").Call("parse", `{"Inner": {"a": {"Values": ["x", "y"]}}}`)
+
+	var wg sync.WaitGroup
+	results := make([]concurrentOuter, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conv, err := jsToGo(reflect.TypeOf(concurrentOuter{}))
+			if err == nil {
+				results[i] = conv(data).Interface().(concurrentOuter)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		testza.AssertEqual(t, []string{"x", "y"}, result.Inner["a"].Values)
+	}
+}
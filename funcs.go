@@ -5,6 +5,6 @@ package crystalline
 import "reflect"
 
 // convertFunc is just a placeholder
-func convertFunc(_ reflect.Value, _ bool) (interface{}, error) {
+func convertFunc(_ reflect.Value, _ bool, _ mapSettings) (interface{}, error) {
 	return nil, nil
 }
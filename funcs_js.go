@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strconv"
 	"syscall/js"
 )
 
@@ -15,15 +16,53 @@ func init() {
 	promiseConstructor = js.Global().Get("Promise")
 }
 
-func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
+// throwing makes a function throw the error it reports through goInternalError. Go cannot throw into JS,
+// so it goes through the wrap helper the generated glue publishes as goWrap. Without the glue the error
+// is only left in goInternalError.
+func throwing(fn js.Value) js.Value {
+	wrap := js.Global().Get("goWrap")
+	if wrap.Type() != js.TypeFunction {
+		return fn
+	}
+	return wrap.Invoke(fn)
+}
+
+// thrownError carries the trailing error of a crystalline:throws function out of the call
+type thrownError struct {
+	err error
+}
+
+func convertFunc(value reflect.Value, promise bool, settings mapSettings) (interface{}, error) {
 	valueType := value.Type()
 
+	throws := settings.throws && valueType.NumOut() > 0 && valueType.Out(valueType.NumOut()-1) == errorType
+	settings.throws = false
+
+	strict := settings.strict || settings.options != nil && settings.options.Strict
+	settings.strict = false
+
+	// Converters are built at the first call, so broken validate tags are reported now
+	if err := checkValidationTags(valueType, make(map[reflect.Type]bool)); err != nil {
+		return nil, err
+	}
+
 	var converters []converter = nil
-	hasPromise := false
+	var paths []bool
 
-	catcher := func(args []reflect.Value) []reflect.Value {
+	catcher := func(args []js.Value) []reflect.Value {
 		defer func() {
 			if err := recover(); err != nil {
+				// Promises reject with whatever failed, failed callbacks with their original JS value
+				if promise {
+					panic(err)
+				}
+
+				// Rejected arguments are the fault of the caller, so they are reported without a stack
+				if validationErr, ok := err.(*ValidationError); ok {
+					js.Global().Set("goInternalError", validationErr.Error())
+					return
+				}
+
 				var stack [8192]byte
 				n := runtime.Stack(stack[:], false)
 				message := fmt.Sprintf("Panic: %s\n%s", err, stack[:n])
@@ -31,7 +70,20 @@ func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
 			}
 		}()
 
-		return value.Call(args)
+		mappedIn := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			if converters[i] == nil {
+				continue
+			}
+
+			if paths[i] {
+				mappedIn[i] = convertAt(converters[i], arg, "args["+strconv.Itoa(i)+"]")
+			} else {
+				mappedIn[i] = converters[i](arg)
+			}
+		}
+
+		return value.Call(mappedIn)
 	}
 
 	baseFunc := func(_ js.Value, args []js.Value) (result any) {
@@ -39,22 +91,22 @@ func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
 			panic(fmt.Sprintf("expected %d arguments, got %d", valueType.NumIn(), len(args)))
 		}
 
-		mappedIn := make([]reflect.Value, len(args))
-		for i, arg := range args {
-			if converters[i] != nil {
-				mappedIn[i] = converters[i](arg)
+		out := catcher(args)
+
+		if throws && len(out) > 0 {
+			if errValue := out[len(out)-1]; !errValue.IsNil() {
+				panic(thrownError{errValue.Interface().(error)})
 			}
+			out = out[:len(out)-1]
 		}
 
-		out := catcher(mappedIn)
-
 		if len(out) == 0 {
 			return nil
 		}
 
 		mappedOut := make([]interface{}, len(out))
 		for i, v := range out {
-			result, err := mapInternal(v, true, false)
+			result, err := mapInternal(v, true, false, settings)
 			if err != nil {
 				panic(fmt.Errorf("failed internal mapping: %w", err))
 			}
@@ -68,7 +120,21 @@ func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
 		return mappedOut
 	}
 
-	finalFunc := baseFunc
+	finalFunc := func(this js.Value, args []js.Value) (result any) {
+		defer func() {
+			if err := recover(); err != nil {
+				thrown, ok := err.(thrownError)
+				if !ok {
+					panic(err)
+				}
+				js.Global().Set("goInternalError", thrown.err.Error())
+				result = nil
+			}
+		}()
+
+		return baseFunc(this, args)
+	}
+
 	promiseFunc := func(this js.Value, args []js.Value) any {
 		return promiseConstructor.New(js.FuncOf(func(_ js.Value, promiseArgs []js.Value) any {
 			resolve := promiseArgs[0]
@@ -77,6 +143,23 @@ func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
 			go func() {
 				defer func() {
 					if err := recover(); err != nil {
+						if thrown, ok := err.(thrownError); ok {
+							jsErr, _ := convertError(thrown.err)
+							reject.Invoke(jsErr)
+							return
+						}
+
+						if jsErr, ok := err.(*JSError); ok {
+							reject.Invoke(jsErr.value)
+							return
+						}
+
+						if validationErr, ok := err.(*ValidationError); ok {
+							jsErr, _ := convertError(validationErr)
+							reject.Invoke(jsErr)
+							return
+						}
+
 						var stack [8192]byte
 						n := runtime.Stack(stack[:], false)
 						reject.Invoke(fmt.Sprintf("Panic: %s\n%s", err, stack[:n]))
@@ -94,29 +177,30 @@ func convertFunc(value reflect.Value, promise bool) (interface{}, error) {
 		finalFunc = promiseFunc
 	}
 
-	return js.FuncOf(func(this js.Value, args []js.Value) any {
+	fn := js.FuncOf(func(this js.Value, args []js.Value) any {
 		if converters == nil {
+			// Promise functions run in a goroutine, so only their callbacks can return a promise to await
+			mode := converterMode{strict: strict, async: promise, defaults: settings.nested().defaults()}
+
 			converters = make([]converter, valueType.NumIn())
+			paths = make([]bool, valueType.NumIn())
 			for i := 0; i < valueType.NumIn(); i++ {
-				in := valueType.In(i)
-
-				if in.Kind() == reflect.Func {
-					hasPromise = true
-				}
-
-				var err error
-				conv, err := jsToGo(in)
+				conv, err := jsToGoWith(valueType.In(i), mode)
 				converters[i] = conv
 				if err != nil {
 					panic(fmt.Errorf("failed conversion from js to go: %w", err))
 				}
+				paths[i] = strict || hasValidation(valueType.In(i), make(map[reflect.Type]bool))
 			}
 		}
 
-		if hasPromise {
-			return promiseFunc(this, args)
-		}
-
 		return finalFunc(this, args)
-	}), nil
+	})
+
+	// Methods are not wrapped by the generated glue, so throwing functions raise the error themselves
+	if throws {
+		return throwing(fn.Value), nil
+	}
+
+	return fn, nil
 }
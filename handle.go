@@ -0,0 +1,26 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// JSValue is just a placeholder
+type JSValue struct{}
+
+// Handle is just a placeholder
+type Handle[T any] struct {
+	_ handleMarker
+}
+
+// convertHandle is just a placeholder
+func convertHandle(_ reflect.Value) interface{} {
+	return nil
+}
+
+func (JSValue) handleType() reflect.Type {
+	return nil
+}
+
+func (Handle[T]) handleType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
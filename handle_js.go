@@ -0,0 +1,57 @@
+//go:build js
+
+package crystalline
+
+import (
+	"reflect"
+	"syscall/js"
+)
+
+var jsValueType = reflect.TypeOf(js.Value{})
+
+// JSValue is a JS value passed between Go and JS untouched, typed as unknown
+type JSValue struct {
+	js.Value
+
+	// mode is the mode of the converter that received the value, which CallMethod converts its methods with
+	mode converterMode
+}
+
+// Handle is a reference to a JS object, typed as the TS type named like T.
+// T is usually an empty marker type, e.g. type HTMLCanvasElement struct{}
+type Handle[T any] struct {
+	_ handleMarker
+	js.Value
+}
+
+// NewHandle wraps a JS object in a typed handle
+func NewHandle[T any](value js.Value) Handle[T] {
+	return Handle[T]{Value: value}
+}
+
+func (JSValue) handleType() reflect.Type {
+	return nil
+}
+
+func (Handle[T]) handleType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// convertHandle returns the JS value held by a handle or an implementation of an interface, or js.Value itself
+func convertHandle(value reflect.Value) interface{} {
+	if value.Type() == jsValueType {
+		return value.Interface()
+	}
+	// Handles hold a js.Value, implementations of interfaces embed a JSValue promoting it
+	return value.FieldByName("Value").Interface()
+}
+
+// handleToGo builds a handle of the given type holding the JS value
+func handleToGo(hint reflect.Type, data js.Value) reflect.Value {
+	if hint == jsValueType {
+		return reflect.ValueOf(data)
+	}
+	result := reflect.New(hint).Elem()
+	result.FieldByName("Value").Set(reflect.ValueOf(data))
+	return result
+}
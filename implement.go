@@ -0,0 +1,64 @@
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	implementations      = make(map[reflect.Type]func(object JSValue) any)
+	adapters             = make(map[reflect.Type]bool)
+	implementationsMutex sync.RWMutex
+)
+
+// RegisterInterface registers the Go implementation of the interface I built for JS objects passed as I.
+// crystalline-expose generates it for interfaces with a crystalline:implement directive.
+func RegisterInterface[I any](implement func(object JSValue) I) {
+	typeDef := reflect.TypeOf((*I)(nil)).Elem()
+	if typeDef.Kind() != reflect.Interface {
+		panic(fmt.Errorf("%s is not an interface", typeDef))
+	}
+
+	implementationsMutex.Lock()
+	defer implementationsMutex.Unlock()
+
+	implementations[typeDef] = func(object JSValue) any {
+		return implement(object)
+	}
+
+	// Adapters map back to the JS object they wrap, so it keeps its identity when returned to JS
+	if adapter := reflect.TypeOf(implement(JSValue{})); adapter != nil {
+		for adapter.Kind() == reflect.Pointer {
+			adapter = adapter.Elem()
+		}
+		adapters[adapter] = true
+	}
+}
+
+// implementation returns the registered implementation of an interface, or nil
+func implementation(typeDef reflect.Type) func(object JSValue) any {
+	implementationsMutex.RLock()
+	defer implementationsMutex.RUnlock()
+
+	return implementations[typeDef]
+}
+
+// isAdapter reports whether a type is a registered implementation of an interface
+func isAdapter(typeDef reflect.Type) bool {
+	implementationsMutex.RLock()
+	defer implementationsMutex.RUnlock()
+
+	return adapters[typeDef]
+}
+
+// isImplemented reports whether JS objects can be passed as the interface
+func isImplemented(typeDef reflect.Type) bool {
+	return typeDef.Kind() == reflect.Interface && implementation(typeDef) != nil
+}
+
+// Out returns the result i of CallMethod as T, or the zero value of T if it is nil
+func Out[T any](results []any, i int) T {
+	result, _ := results[i].(T)
+	return result
+}
@@ -0,0 +1,19 @@
+package crystalline
+
+// JSError is an exception thrown or a promise rejected by a JS callback called from Go.
+// Callbacks whose Go signature ends in error return it, others propagate it to the enclosing promise.
+type JSError struct {
+	Name    string
+	Message string
+	Stack   string
+
+	// value is the thrown JS value
+	value any
+}
+
+func (e *JSError) Error() string {
+	if e.Name == "" {
+		return e.Message
+	}
+	return e.Name + ": " + e.Message
+}
@@ -163,14 +163,14 @@ func (s Sample) Greet(name string) string {
 func TestStructs(t *testing.T) {
 	result, err := Map(Sample{Greeting: "Hello, "})
 	testza.AssertNoError(t, err)
-	testza.AssertEqual(t, "Hello, ", (result.(map[string]interface{}))["Greeting"])
+	testza.AssertEqual(t, "Hello, ", snapshotString(result, "Greeting"))
 }
 
 func TestInterface(t *testing.T) {
 	var greetable Greetable = Sample{Greeting: "Hello, "}
 	result, err := Map(&greetable)
 	testza.AssertNoError(t, err)
-	testza.AssertEqual(t, "Hello, ", (result.(map[string]interface{}))["Greeting"])
+	testza.AssertEqual(t, "Hello, ", snapshotString(result, "Greeting"))
 }
 
 func TestPointer(t *testing.T) {
@@ -182,12 +182,12 @@ func TestPointer(t *testing.T) {
 
 func TestUnsafePointer(t *testing.T) {
 	var greetable Greetable = &Sample{Greeting: "Hello, "}
-	result, err := mapInternal(reflect.ValueOf(reflect.ValueOf(greetable).UnsafePointer()), false, false)
+	result, err := mapInternal(reflect.ValueOf(reflect.ValueOf(greetable).UnsafePointer()), false, false, mapSettings{})
 	testza.AssertNoError(t, err)
 	testza.AssertGreater(t, result, 0)
 
 	var fakeInterface *Greetable
-	result, err = mapInternal(reflect.ValueOf(reflect.ValueOf(fakeInterface).UnsafePointer()), false, false)
+	result, err = mapInternal(reflect.ValueOf(reflect.ValueOf(fakeInterface).UnsafePointer()), false, false, mapSettings{})
 	testza.AssertNoError(t, err)
 	testza.AssertEqual(t, nil, result)
 }
@@ -4,28 +4,54 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
+	"sync"
 )
 
 var (
 	promisified = make(map[string]map[string]bool)
 	ignored     = make(map[string]map[string]bool)
+	structModes = make(map[string]StructMode)
+	marksMutex  sync.RWMutex
 )
 
+// MarkIgnored hides a method from JS, for types whose source cannot carry a crystalline:ignore directive
+//
+// Deprecated: Use WithIgnored
 func MarkIgnored(entity string, fn string) {
-	if _, ok := ignored[entity]; !ok {
-		ignored[entity] = make(map[string]bool)
-	}
+	marksMutex.Lock()
+	defer marksMutex.Unlock()
 
-	ignored[entity][fn] = true
+	mark(ignored, entity, fn)
 }
 
+// MarkPromise makes a method return a Promise, for types whose source cannot carry a crystalline:promise directive
+//
+// Deprecated: Use WithPromise
 func MarkPromise(entity string, fn string) {
-	if _, ok := promisified[entity]; !ok {
-		promisified[entity] = make(map[string]bool)
-	}
+	marksMutex.Lock()
+	defer marksMutex.Unlock()
+
+	mark(promisified, entity, fn)
+}
+
+// MarkLive makes every value of the given type map as a live proxy
+//
+// Deprecated: Use WithLive
+func MarkLive(entity string) {
+	marksMutex.Lock()
+	defer marksMutex.Unlock()
+
+	structModes[entity] = StructModeLive
+}
+
+// MarkSnapshot makes every value of the given type map as a snapshot copy
+//
+// Deprecated: Use WithSnapshot
+func MarkSnapshot(entity string) {
+	marksMutex.Lock()
+	defer marksMutex.Unlock()
 
-	promisified[entity][fn] = true
+	structModes[entity] = StructModeSnapshot
 }
 
 func MapOrPanic(data interface{}) interface{} {
@@ -33,7 +59,7 @@ func MapOrPanic(data interface{}) interface{} {
 }
 
 func MapOrPanicPromise(data interface{}, promise bool) interface{} {
-	result, err := mapInternal(reflect.ValueOf(data), promise, false)
+	result, err := mapInternal(reflect.ValueOf(data), promise, false, mapSettings{})
 	if err != nil {
 		panic(fmt.Errorf("failed internal mapping: %w", err))
 	}
@@ -45,10 +71,10 @@ func Map(data interface{}) (interface{}, error) {
 }
 
 func MapPromise(data interface{}, promise bool) (interface{}, error) {
-	return mapInternal(reflect.ValueOf(data), promise, false)
+	return mapInternal(reflect.ValueOf(data), promise, false, mapSettings{})
 }
 
-func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, error) {
+func mapInternal(value reflect.Value, promise bool, nonNil bool, settings mapSettings) (interface{}, error) {
 	switch value.Kind() {
 	case reflect.Invalid:
 		return nil, errors.New("invalid value kind")
@@ -59,21 +85,41 @@ func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, e
 	case reflect.Complex128:
 		return nil, errors.New("complex128 cannot be converted to wasm")
 	case reflect.Slice:
+		// Copies of collections are not written back, so only settable ones are proxied
+		if settings.structMode == StructModeLive && !isBytes(value.Type()) && value.CanSet() {
+			return convertCollection(value, settings)
+		}
+
 		if value.IsNil() {
 			if nonNil {
+				if typedArrayName(value.Type().Elem().Kind()) != "" {
+					return convertTypedArray(value, false)
+				}
 				return make([]interface{}, 0), nil
 			}
-			return nil, nil
+			return settings.nilValue(), nil
+		}
+
+		if value.Len() > 0 {
+			done, err := settings.visit(value)
+			if err != nil {
+				return nil, err
+			}
+			defer done()
 		}
 		fallthrough
 	case reflect.Array:
-		if value.Type().String() == "[]uint8" {
-			return convertByteArray(value.Interface().([]uint8))
+		if isBytes(value.Type()) && value.Kind() == reflect.Slice {
+			return convertByteArray(value.Bytes())
+		}
+
+		if typedArrayName(value.Type().Elem().Kind()) != "" {
+			return convertTypedArray(value, settings.views())
 		}
 
 		out := make([]interface{}, value.Len())
 		for i := 0; i < value.Len(); i++ {
-			val, err := mapInternal(value.Index(i), false, false)
+			val, err := mapInternal(value.Index(i), false, false, settings)
 			if err != nil {
 				return nil, err
 			}
@@ -82,37 +128,62 @@ func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, e
 		return out, nil
 	case reflect.Func:
 		if value.IsNil() {
-			return nil, nil
+			return settings.nilValue(), nil
 		}
-		return convertFunc(value, promise)
+		return convertFunc(value, promise, settings)
 	case reflect.Pointer:
 		fallthrough
 	case reflect.Interface:
 		if value.IsNil() {
-			return nil, nil
+			if nonNil && value.Kind() == reflect.Pointer {
+				return mapInternal(reflect.New(value.Type().Elem()).Elem(), false, false, settings)
+			}
+			return settings.nilValue(), nil
 		}
 
 		if err, ok := value.Interface().(error); ok {
 			return convertError(err)
 		}
 
-		return mapInternal(value.Elem(), false, false)
+		if emitterPayload(value.Type()) != nil {
+			return convertEmitter(value, settings), nil
+		}
+
+		if value.Kind() == reflect.Pointer {
+			done, err := settings.visit(value)
+			if err != nil {
+				return nil, err
+			}
+			defer done()
+		}
+
+		return mapInternal(value.Elem(), false, false, settings)
 	case reflect.Map:
+		if settings.structMode == StructModeLive && value.CanSet() {
+			return convertCollection(value, settings)
+		}
+
 		if value.IsNil() {
 			if nonNil {
 				return make(map[string]interface{}), nil
 			}
-			return nil, nil
+			return settings.nilValue(), nil
 		}
 
+		done, err := settings.visit(value)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
 		out := make(map[string]interface{})
 		i := value.MapRange()
 		for i.Next() {
-			key, err := mapInternal(i.Key(), false, false)
+			key, err := mapInternal(i.Key(), false, false, settings)
 			if err != nil {
 				return nil, err
 			}
-			val, err := mapInternal(i.Value(), false, false)
+			val, err := mapInternal(i.Value(), false, false, settings)
 			if err != nil {
 				return nil, err
 			}
@@ -120,24 +191,32 @@ func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, e
 		}
 		return out, nil
 	case reflect.Struct:
-		if value.CanAddr() {
-			return convertStruct(value)
+		if isHandle(value.Type()) || isAdapter(value.Type()) {
+			return convertHandle(value), nil
+		}
+
+		// Copies of structs are not written back, so only addressable ones are proxied
+		if value.CanAddr() && settings.isLive(value.Type(), true) {
+			return convertStruct(value, settings.nested())
+		}
+
+		fields, names, err := exposedFields(value.Type())
+		if err != nil {
+			return nil, err
 		}
 
 		out := make(map[string]interface{})
-		for i := 0; i < value.NumField(); i++ {
+		keys := make([]string, 0, len(fields))
+		for n, i := range fields {
 			structField := value.Type().Field(i)
-			if structField.PkgPath != "" {
-				continue
-			}
-
-			notNil := strings.Contains(structField.Tag.Get("crystalline"), "not_nil")
+			notNil := hasTagOption(structField, "not_nil")
 
-			val, err := mapInternal(value.Field(i), false, notNil)
+			val, err := mapInternal(value.Field(i), false, notNil, settings.field(structField))
 			if err != nil {
 				return nil, err
 			}
-			out[structField.Name] = val
+			out[names[n]] = val
+			keys = append(keys, names[n])
 		}
 
 		for i := 0; i < value.NumMethod(); i++ {
@@ -146,26 +225,28 @@ func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, e
 				continue
 			}
 
-			methodPromise := false
-			fn := findFunction(method.Func.Pointer())
-			if fn != nil && fn.Doc != nil {
-				for _, comment := range fn.Doc.List {
-					if comment != nil {
-						if strings.Contains(comment.Text, "crystalline:promise") {
-							methodPromise = true
-						}
-					}
-				}
+			directives, err := methodDirectives(value.Type(), method.Name, settings.opts())
+			if err != nil {
+				return nil, err
 			}
 
-			val, err := mapInternal(value.Method(i), methodPromise, false)
+			if directives.Ignore {
+				continue
+			}
+
+			methodSettings := settings.nested()
+			methodSettings.throws = directives.Throws
+			methodSettings.strict = directives.StrictArgs
+
+			val, err := mapInternal(value.Method(i), directives.Promise, false, methodSettings)
 			if err != nil {
 				return nil, err
 			}
-			out[method.Name] = val
+			out[directives.jsName(method.Name)] = val
+			keys = append(keys, directives.jsName(method.Name))
 		}
 
-		return out, nil
+		return snapshotObject(keys, out), nil
 	case reflect.Bool:
 		return value.Bool(), nil
 	case reflect.Int:
@@ -198,7 +279,7 @@ func mapInternal(value reflect.Value, promise bool, nonNil bool) (interface{}, e
 		return value.String(), nil
 	case reflect.UnsafePointer:
 		if value.IsNil() {
-			return nil, nil
+			return settings.nilValue(), nil
 		}
 
 		return value.Pointer(), nil
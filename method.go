@@ -0,0 +1,19 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// CallMethod is just a placeholder, returning the zero values of the method results
+func CallMethod[I any](_ JSValue, name string, _ ...any) []any {
+	method, ok := reflect.TypeOf((*I)(nil)).Elem().MethodByName(name)
+	if !ok {
+		return nil
+	}
+
+	results := make([]any, method.Type.NumOut())
+	for i := range results {
+		results[i] = reflect.Zero(method.Type.Out(i)).Interface()
+	}
+	return results
+}
@@ -0,0 +1,54 @@
+//go:build js
+
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+	"syscall/js"
+)
+
+// CallMethod calls the method of a JS object implementing the interface I, converting the arguments and results
+// like for any other JS callback. Methods of objects passed to promise functions may return a promise Go awaits.
+func CallMethod[I any](object JSValue, name string, args ...any) []any {
+	typeDef := reflect.TypeOf((*I)(nil)).Elem()
+
+	method, ok := typeDef.MethodByName(name)
+	if !ok {
+		panic(fmt.Errorf("%s has no method %s", typeDef, name))
+	}
+
+	fn := object.Get(name)
+	if fn.Type() != js.TypeFunction {
+		panic(fmt.Errorf("the JS object implementing %s has no method %s", typeDef, name))
+	}
+
+	conv, err := jsToGoWith(method.Type, object.mode)
+	if err != nil {
+		panic(fmt.Errorf("failed conversion from js to go: %w", err))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		in[i] = reflect.New(method.Type.In(i)).Elem()
+		if arg != nil {
+			in[i].Set(reflect.ValueOf(arg))
+		}
+	}
+
+	goFn := conv(fn.Call("bind", object.Value))
+
+	var out []reflect.Value
+	if method.Type.IsVariadic() {
+		out = goFn.CallSlice(in)
+	} else {
+		out = goFn.Call(in)
+	}
+
+	results := make([]any, len(out))
+	for i, value := range out {
+		results[i] = value.Interface()
+	}
+
+	return results
+}
@@ -0,0 +1,16 @@
+//go:build !js
+
+package crystalline
+
+import (
+	"testing"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+func TestCallMethodPlaceholder(t *testing.T) {
+	// Adapters index the results, so outside of wasm they get the zero values
+	value, err := jsKeyStore{}.Get("key")
+	testza.AssertEqual(t, "", value)
+	testza.AssertNil(t, err)
+}
@@ -1,6 +1,9 @@
 package crystalline
 
-import "syscall/js"
+import (
+	"strings"
+	"syscall/js"
+)
 
 func setNamespace(appName string, packageName string, name string, value interface{}) {
 	goNs := js.Global().Get("go")
@@ -15,11 +18,18 @@ func setNamespace(appName string, packageName string, name string, value interfa
 		appNs = goNs.Get(appName)
 	}
 
-	pkgNs := appNs.Get(packageName)
-	if pkgNs.IsUndefined() {
-		appNs.Set(packageName, make(map[string]interface{}))
-		pkgNs = appNs.Get(packageName)
+	ns := appNs
+	if packageName != "" {
+		for _, segment := range strings.Split(packageName, ".") {
+			segment = namespaceCleaner.ReplaceAllLiteralString(segment, "_")
+			next := ns.Get(segment)
+			if next.IsUndefined() {
+				ns.Set(segment, make(map[string]interface{}))
+				next = ns.Get(segment)
+			}
+			ns = next
+		}
 	}
 
-	pkgNs.Set(name, value)
+	ns.Set(name, value)
 }
@@ -0,0 +1,19 @@
+package crystalline
+
+// NilMode controls which JS value nil slices, maps, pointers, funcs and interfaces are mapped to
+type NilMode int
+
+const (
+	// NilAsNull maps nil values to null
+	NilAsNull NilMode = iota
+
+	// NilAsUndefined maps nil values to undefined
+	NilAsUndefined
+)
+
+func (s mapSettings) nilValue() interface{} {
+	if s.nilMode == NilAsUndefined {
+		return jsUndefined()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Observable opts a struct into change notification when embedded. Its live JS objects get a subscribe method
+// following the Svelte store contract, called on every field set from JS and on every Notify from Go.
+type Observable struct{}
+
+var observableType = reflect.TypeOf(Observable{})
+
+// isObservable reports whether a struct embeds Observable
+func isObservable(typeDef reflect.Type) bool {
+	if typeDef.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < typeDef.NumField(); i++ {
+		if field := typeDef.Field(i); field.Anonymous && field.Type == observableType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Notify tells the JS subscribers of an observable struct that a field changed from Go
+func Notify(target any, field string) {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() || !isObservable(value.Type().Elem()) {
+		panic(fmt.Errorf("notify expects a pointer to a struct embedding crystalline.Observable, got %T", target))
+	}
+
+	typeDef := value.Type().Elem()
+
+	fields, names, err := exposedFields(typeDef)
+	if err != nil {
+		panic(err)
+	}
+
+	for n, i := range fields {
+		if typeDef.Field(i).Name == field {
+			notifyObservers(value.Elem(), names[n])
+			return
+		}
+	}
+
+	panic(fmt.Errorf("%s has no exposed field %s", typeDef, field))
+}
@@ -0,0 +1,8 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// notifyObservers is just a placeholder
+func notifyObservers(_ reflect.Value, _ string) {}
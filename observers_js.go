@@ -0,0 +1,125 @@
+//go:build js
+
+package crystalline
+
+import (
+	"reflect"
+	"sync"
+	"syscall/js"
+)
+
+// observerKey identifies a struct value, a struct and its first field share the same address
+type observerKey struct {
+	pointer uintptr
+	typeDef reflect.Type
+}
+
+// observer holds the subscribers of a struct value. It keeps the value alive,
+// so its address cannot be reused by another struct while it has subscribers.
+type observer struct {
+	value         reflect.Value
+	object        js.Value
+	subscriptions []subscription
+}
+
+// subscription is one call to subscribe, the same run may subscribe several times
+type subscription struct {
+	id  int
+	run js.Value
+}
+
+var (
+	observers        = make(map[observerKey]*observer)
+	nextSubscription int
+	observersMutex   sync.Mutex
+)
+
+// observedObject returns the live object of a struct value that has subscribers,
+// so mapping it again keeps the object they subscribed to
+func observedObject(value reflect.Value) (js.Value, bool) {
+	observersMutex.Lock()
+	defer observersMutex.Unlock()
+
+	entry, ok := observers[observerKey{pointer: value.UnsafeAddr(), typeDef: value.Type()}]
+	if !ok {
+		return js.Value{}, false
+	}
+	return entry.object, true
+}
+
+// subscribeFunc returns the subscribe method of the live object of an observable struct.
+// Following the Svelte store contract, it calls run with the current value and returns the unsubscribe function.
+func subscribeFunc(value reflect.Value, object *js.Value) js.Value {
+	key := observerKey{pointer: value.UnsafeAddr(), typeDef: value.Type()}
+
+	// Unsubscribing binds this function to the subscription id, so there is one per object instead of one per subscription
+	unsubscribeFunc := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		unsubscribe(key, args[0].Int())
+		return nil
+	})
+
+	return throwing(js.FuncOf(func(_ js.Value, args []js.Value) any {
+		// A panic here would end the Go program, so the mistake is thrown in JS instead
+		if len(args) == 0 || args[0].Type() != js.TypeFunction {
+			reportTypeError("expected a subscriber function")
+			return nil
+		}
+
+		run := args[0]
+
+		observersMutex.Lock()
+		entry, ok := observers[key]
+		if !ok {
+			entry = &observer{value: value, object: *object}
+			observers[key] = entry
+		}
+		nextSubscription++
+		id := nextSubscription
+		entry.subscriptions = append(entry.subscriptions, subscription{id: id, run: run})
+		observersMutex.Unlock()
+
+		callListener(run, *object)
+
+		return unsubscribeFunc.Call("bind", js.Null(), id)
+	}).Value)
+}
+
+// unsubscribe removes a single subscription, calling its unsubscribe function again does nothing
+func unsubscribe(key observerKey, id int) {
+	observersMutex.Lock()
+	defer observersMutex.Unlock()
+
+	entry, ok := observers[key]
+	if !ok {
+		return
+	}
+
+	kept := entry.subscriptions[:0]
+	for _, existing := range entry.subscriptions {
+		if existing.id != id {
+			kept = append(kept, existing)
+		}
+	}
+	entry.subscriptions = kept
+
+	// Without subscribers the value and its object are left to the garbage collector and the weak cache
+	if len(entry.subscriptions) == 0 {
+		delete(observers, key)
+	}
+}
+
+// notifyObservers calls the subscribers of a struct value with its live object and the JS name of the changed field
+func notifyObservers(value reflect.Value, field string) {
+	observersMutex.Lock()
+	entry, ok := observers[observerKey{pointer: value.UnsafeAddr(), typeDef: value.Type()}]
+	var subscriptions []subscription
+	if ok {
+		subscriptions = make([]subscription, len(entry.subscriptions))
+		copy(subscriptions, entry.subscriptions)
+	}
+	observersMutex.Unlock()
+
+	for _, subscribed := range subscriptions {
+		callListener(subscribed.run, entry.object, field)
+	}
+}
@@ -0,0 +1,223 @@
+package crystalline
+
+// Options holds the configuration of a single Exposer
+type Options struct {
+	// Promisified lists methods per type name that return a Promise
+	Promisified map[string]map[string]bool
+	// Ignored lists methods per type name that are hidden from JS
+	Ignored map[string]map[string]bool
+	// StructModes sets the mode of every value of a struct type, per type name
+	StructModes map[string]StructMode
+	// QuoteStyle is the quote used for strings in the generated JS
+	QuoteStyle string
+	// TrailingComma adds a comma after the last member of generated JS objects
+	TrailingComma bool
+	// Target is the module format of the generated JS
+	Target Target
+	// WasmPath is the wasm binary loaded by TargetNode, relative to the generated JS
+	WasmPath string
+	// WasmExecPath is the wasm_exec.js required by TargetNode and the worker script
+	WasmExecPath string
+	// Worker runs the wasm in a Web Worker, with the generated JS forwarding calls to it
+	Worker bool
+	// Strict makes every function reject arguments that do not match their Go types
+	Strict bool
+	// StructMode is the default mode of exposed structs
+	StructMode StructMode
+	// TypedArrayViews maps numeric slices to typed arrays sharing the wasm memory
+	TypedArrayViews bool
+	// NilMode sets whether nil values are exposed as null or undefined
+	NilMode NilMode
+	// EnumStyle sets how types marked with crystalline:enum are written to the typings
+	EnumStyle EnumStyle
+}
+
+// Option configures an Exposer created by NewExposer
+type Option func(*Options)
+
+// markedOptions are the options of values mapped without an exposer. They are built from the deprecated
+// globals once, and rebuilt when those change. Guarded by marksMutex.
+var markedOptions *Options
+
+// globalOptions returns the options of values mapped without an exposer
+func globalOptions() *Options {
+	marksMutex.RLock()
+	options := markedOptions
+	marksMutex.RUnlock()
+
+	if options != nil && options.QuoteStyle == JSQuoteStyle && options.TrailingComma == JSTrailingComma {
+		return options
+	}
+
+	options = defaultOptions()
+
+	marksMutex.Lock()
+	markedOptions = options
+	marksMutex.Unlock()
+
+	return options
+}
+
+// defaultOptions copies the deprecated formatting globals, so they keep working as defaults.
+// The deprecated marks are looked up when used instead, so they apply to every exposer.
+func defaultOptions() *Options {
+	return &Options{
+		Promisified:   make(map[string]map[string]bool),
+		Ignored:       make(map[string]map[string]bool),
+		StructModes:   make(map[string]StructMode),
+		QuoteStyle:    JSQuoteStyle,
+		TrailingComma: JSTrailingComma,
+		WasmExecPath:  "./wasm_exec.js",
+	}
+}
+
+func mark(marks map[string]map[string]bool, entity string, fn string) {
+	if _, ok := marks[entity]; !ok {
+		marks[entity] = make(map[string]bool)
+	}
+
+	marks[entity][fn] = true
+}
+
+// WithPromise makes a method return a Promise
+func WithPromise(entity string, fn string) Option {
+	return func(o *Options) {
+		mark(o.Promisified, entity, fn)
+	}
+}
+
+// WithIgnored hides a method from JS
+func WithIgnored(entity string, fn string) Option {
+	return func(o *Options) {
+		mark(o.Ignored, entity, fn)
+	}
+}
+
+// WithLive makes every value of the given struct type map as a live proxy
+func WithLive(entity string) Option {
+	return func(o *Options) {
+		o.StructModes[entity] = StructModeLive
+	}
+}
+
+// WithSnapshot makes every value of the given struct type map as a snapshot copy
+func WithSnapshot(entity string) Option {
+	return func(o *Options) {
+		o.StructModes[entity] = StructModeSnapshot
+	}
+}
+
+// WithQuoteStyle sets the quote used for strings in the generated JS
+func WithQuoteStyle(quote string) Option {
+	return func(o *Options) {
+		o.QuoteStyle = quote
+	}
+}
+
+// WithTrailingComma sets whether the last member of generated JS objects is followed by a comma
+func WithTrailingComma(enabled bool) Option {
+	return func(o *Options) {
+		o.TrailingComma = enabled
+	}
+}
+
+// WithTarget sets the module format of the generated JS
+func WithTarget(target Target) Option {
+	return func(o *Options) {
+		o.Target = target
+	}
+}
+
+// WithWasmPath sets the wasm binary loaded by TargetNode, defaulting to the app name with a .wasm extension
+func WithWasmPath(path string) Option {
+	return func(o *Options) {
+		o.WasmPath = path
+	}
+}
+
+// WithWasmExecPath sets the wasm_exec.js required by TargetNode
+func WithWasmExecPath(path string) Option {
+	return func(o *Options) {
+		o.WasmExecPath = path
+	}
+}
+
+// WithWorker makes Build generate a proxy that forwards every call to a Web Worker hosting the wasm,
+// which runs the script generated by BuildWorker. Structs are mapped as snapshots, as live values cannot be cloned.
+func WithWorker(enabled bool) Option {
+	return func(o *Options) {
+		o.Worker = enabled
+	}
+}
+
+// WithStrict makes every exposed function reject arguments with unknown properties, missing not_nil fields
+// or mismatched types, instead of zero-filling them. Single functions opt in with crystalline:strict.
+func WithStrict(enabled bool) Option {
+	return func(o *Options) {
+		o.Strict = enabled
+	}
+}
+
+// WithStructMode sets the default mode of exposed structs
+func WithStructMode(mode StructMode) Option {
+	return func(o *Options) {
+		o.StructMode = mode
+	}
+}
+
+// WithTypedArrayViews makes numeric slices map to typed arrays that share the wasm memory instead of copying it.
+// The views are only valid while the Go slice is alive and until the wasm memory grows.
+func WithTypedArrayViews(enabled bool) Option {
+	return func(o *Options) {
+		o.TypedArrayViews = enabled
+	}
+}
+
+// WithNilMode sets whether nil values are exposed as null or undefined, for both the runtime and the typings
+func WithNilMode(mode NilMode) Option {
+	return func(o *Options) {
+		o.NilMode = mode
+	}
+}
+
+// WithEnumStyle sets how types marked with crystalline:enum are written to the typings
+func WithEnumStyle(style EnumStyle) Option {
+	return func(o *Options) {
+		o.EnumStyle = style
+	}
+}
+
+func (o *Options) isIgnored(entity string, fn string) bool {
+	if o.Ignored[entity][fn] {
+		return true
+	}
+
+	marksMutex.RLock()
+	defer marksMutex.RUnlock()
+
+	return ignored[entity][fn]
+}
+
+func (o *Options) isPromise(entity string, fn string) bool {
+	if o.Promisified[entity][fn] {
+		return true
+	}
+
+	marksMutex.RLock()
+	defer marksMutex.RUnlock()
+
+	return promisified[entity][fn]
+}
+
+// structMode returns the mode set for a struct type, by the options or the deprecated globals
+func (o *Options) structMode(entity string) (StructMode, bool) {
+	if mode, ok := o.StructModes[entity]; ok {
+		return mode, true
+	}
+
+	marksMutex.RLock()
+	defer marksMutex.RUnlock()
+
+	mode, ok := structModes[entity]
+	return mode, ok
+}
@@ -0,0 +1,8 @@
+//go:build !js
+
+package crystalline
+
+// Ready resolves the promises returned by init in the generated JS of every app exposed by this binary,
+// call it once everything is exposed
+func Ready() {
+}
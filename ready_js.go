@@ -0,0 +1,28 @@
+//go:build js
+
+package crystalline
+
+import "syscall/js"
+
+// Ready resolves the promises returned by init in the generated JS of every app exposed by this binary,
+// call it once everything is exposed
+func Ready() {
+	hooks := js.Global().Get("goReady")
+	if hooks.Type() != js.TypeObject {
+		return
+	}
+
+	exposedAppsMutex.Lock()
+	apps := SortedKeys(exposedApps)
+	exposedAppsMutex.Unlock()
+
+	for _, app := range apps {
+		ready := hooks.Get(app)
+		if ready.Type() != js.TypeFunction {
+			continue
+		}
+
+		hooks.Delete(app)
+		ready.Invoke()
+	}
+}
@@ -2,6 +2,8 @@
 
 set -ex
 
+go test -race ./...
+
 rm -rf test.bin
 GOOS=js GOARCH=wasm go test -c -o test.bin -coverprofile -covermode=atomic -coverpkg=./... ./
 NODE_BIN=$(which node)
@@ -0,0 +1,661 @@
+package crystalline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaKind is the shape of the data a schema node accepts
+type schemaKind int
+
+const (
+	schemaUnknown schemaKind = iota
+	schemaBoolean
+	schemaInteger
+	schemaNumber
+	schemaString
+	schemaBytes
+	schemaArray
+	schemaRecord
+	schemaObject
+	schemaEnum
+	schemaRef
+)
+
+// schemaNode describes the plain data JS may pass for a Go type, shared by the JSON Schema and Zod generators
+type schemaNode struct {
+	kind     schemaKind
+	nullable bool
+	minimum  *float64
+	maximum  *float64
+	items    *schemaNode
+	length   int
+	fields   []schemaField
+	values   []interface{}
+	ref      string
+
+	// minLength, maxLength and pattern come from validate tags
+	minLength *int
+	maxLength *int
+	pattern   string
+}
+
+type schemaField struct {
+	name     string
+	node     *schemaNode
+	required bool
+}
+
+// schemaDefinition is a named type reachable from the exposed values
+type schemaDefinition struct {
+	name    string
+	typeDef reflect.Type
+	values  []interface{}
+}
+
+// schemaBuilder turns the definitions of an exposer into schema nodes
+type schemaBuilder struct {
+	nilMode     NilMode
+	definitions map[string]*schemaDefinition
+}
+
+func (e *Exposer) schemaBuilder() *schemaBuilder {
+	builder := &schemaBuilder{
+		nilMode:     e.options.NilMode,
+		definitions: make(map[string]*schemaDefinition),
+	}
+	builder.collect(e.rootDefinition)
+	return builder
+}
+
+// collect registers the structs and named types of a definition and its nested namespaces
+func (b *schemaBuilder) collect(d *Definition) {
+	for _, typeDef := range d.Definitions {
+		if typeDef.Kind() == reflect.Struct {
+			b.add(typeDef, nil)
+		}
+	}
+
+	for name, typeDef := range d.Aliases {
+		var values []interface{}
+		for _, value := range d.Enums[name] {
+			if goValue, ok := enumGoValue(typeDef, value.Value); ok {
+				values = append(values, goValue.Interface())
+			}
+		}
+		b.add(typeDef, values)
+	}
+
+	for _, nested := range d.Nested {
+		b.collect(nested)
+	}
+}
+
+func (b *schemaBuilder) add(typeDef reflect.Type, values []interface{}) {
+	namespace, name := typeNames(typeDef)
+
+	// Types marked with MarkEnum are validated even without a crystalline:enum directive
+	if values == nil && isEnum(typeDef) {
+		enumMutex.RLock()
+		for value := range enumValues[typeDef] {
+			values = append(values, value)
+		}
+		enumMutex.RUnlock()
+
+		sort.Slice(values, func(i, j int) bool {
+			return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+		})
+	}
+
+	b.definitions[namespace+"."+name] = &schemaDefinition{
+		name:    namespace + "." + name,
+		typeDef: typeDef,
+		values:  values,
+	}
+}
+
+// definitionName returns the name a type is referenced by, or an empty string if it is written inline
+func (b *schemaBuilder) definitionName(typeDef reflect.Type) string {
+	if typeDef.Name() == "" || typeDef.PkgPath() == "" {
+		return ""
+	}
+
+	namespace, name := typeNames(typeDef)
+	if _, ok := b.definitions[namespace+"."+name]; !ok {
+		return ""
+	}
+
+	return namespace + "." + name
+}
+
+// definition returns the body of a definition, like in the typings references carry the nullability of named types
+func (b *schemaBuilder) definition(definition *schemaDefinition) (*schemaNode, error) {
+	if len(definition.values) > 0 {
+		return &schemaNode{kind: schemaEnum, values: definition.values}, nil
+	}
+
+	node, err := b.node(definition.typeDef, true)
+	if err != nil {
+		return nil, err
+	}
+	node.nullable = false
+	return node, nil
+}
+
+// node returns the schema of a type, top is set for the body of a definition
+func (b *schemaBuilder) node(typeDef reflect.Type, top bool) (*schemaNode, error) {
+	if !top {
+		if name := b.definitionName(typeDef); name != "" {
+			return &schemaNode{kind: schemaRef, ref: name, nullable: aliasNullable(typeDef)}, nil
+		}
+	}
+
+	if isHandle(typeDef) || emitterPayload(typeDef) != nil {
+		return &schemaNode{kind: schemaUnknown}, nil
+	}
+
+	switch typeDef.Kind() {
+	case reflect.Bool:
+		return &schemaNode{kind: schemaBoolean}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		bits := typeDef.Bits() - 1
+		minimum, maximum := -float64(int64(1)<<bits), float64(int64(1)<<bits-1)
+		return &schemaNode{kind: schemaInteger, minimum: &minimum, maximum: &maximum}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		minimum, maximum := float64(0), float64(int64(1)<<typeDef.Bits()-1)
+		return &schemaNode{kind: schemaInteger, minimum: &minimum, maximum: &maximum}, nil
+	case reflect.Int, reflect.Int64:
+		return &schemaNode{kind: schemaInteger}, nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		minimum := float64(0)
+		return &schemaNode{kind: schemaInteger, minimum: &minimum}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{kind: schemaNumber}, nil
+	case reflect.String:
+		return &schemaNode{kind: schemaString}, nil
+	case reflect.Slice, reflect.Array:
+		nullable := typeDef.Kind() == reflect.Slice
+		if isBytes(typeDef) {
+			return &schemaNode{kind: schemaBytes, nullable: nullable}, nil
+		}
+
+		items, err := b.node(typeDef.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+
+		length := -1
+		if typeDef.Kind() == reflect.Array {
+			length = typeDef.Len()
+		}
+
+		return &schemaNode{kind: schemaArray, items: items, length: length, nullable: nullable}, nil
+	case reflect.Map:
+		items, err := b.node(typeDef.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: schemaRecord, items: items, nullable: true}, nil
+	case reflect.Pointer:
+		node, err := b.node(typeDef.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		node.nullable = true
+		return node, nil
+	case reflect.Struct:
+		if directives, _ := typeDirectives(typeDef); directives.Ignore {
+			return &schemaNode{kind: schemaUnknown}, nil
+		}
+		return b.object(typeDef)
+	}
+
+	return &schemaNode{kind: schemaUnknown, nullable: typeDef.Kind() == reflect.Interface}, nil
+}
+
+// object returns the schema of the exposed fields of a struct, functions are not data so they are left out
+func (b *schemaBuilder) object(typeDef reflect.Type) (*schemaNode, error) {
+	fields, names, err := exposedFields(typeDef)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &schemaNode{kind: schemaObject}
+	for n, i := range fields {
+		field := typeDef.Field(i)
+		if field.Type.Kind() == reflect.Func || field.Type.Kind() == reflect.Chan {
+			continue
+		}
+
+		fieldNode, err := b.node(field.Type, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasTagOption(field, "not_nil") {
+			fieldNode.nullable = false
+		}
+
+		rules, err := parseValidationRules(field)
+		if err != nil {
+			return nil, err
+		}
+
+		if rules != nil {
+			if fieldNode, err = b.constrain(field.Type, fieldNode, rules); err != nil {
+				return nil, err
+			}
+		}
+
+		node.fields = append(node.fields, schemaField{
+			name:     names[n],
+			node:     fieldNode,
+			required: !fieldNode.nullable,
+		})
+	}
+
+	return node, nil
+}
+
+// constrain applies the rules of a validate tag, named types are written inline as a reference cannot be narrowed
+func (b *schemaBuilder) constrain(typeDef reflect.Type, node *schemaNode, rules *validationRules) (*schemaNode, error) {
+	if node.kind == schemaRef {
+		for typeDef.Kind() == reflect.Pointer {
+			typeDef = typeDef.Elem()
+		}
+
+		inline, err := b.node(typeDef, true)
+		if err != nil {
+			return nil, err
+		}
+		inline.nullable = node.nullable
+		node = inline
+	}
+
+	switch node.kind {
+	case schemaInteger, schemaNumber:
+		if rules.min != nil && (node.minimum == nil || *rules.min > *node.minimum) {
+			node.minimum = rules.min
+		}
+		if rules.max != nil && (node.maximum == nil || *rules.max < *node.maximum) {
+			node.maximum = rules.max
+		}
+	case schemaString, schemaArray, schemaRecord:
+		if rules.min != nil {
+			minLength := int(math.Ceil(*rules.min))
+			node.minLength = &minLength
+		}
+		if rules.max != nil {
+			maxLength := int(math.Floor(*rules.max))
+			node.maxLength = &maxLength
+		}
+		if rules.length != nil {
+			node.minLength, node.maxLength = rules.length, rules.length
+		}
+		if rules.pattern != nil {
+			node.pattern = rules.pattern.String()
+		}
+	}
+
+	return node, nil
+}
+
+// references returns the definitions a node refers to
+func (n *schemaNode) references() []string {
+	refs := make([]string, 0)
+	if n.kind == schemaRef {
+		refs = append(refs, n.ref)
+	}
+	if n.items != nil {
+		refs = append(refs, n.items.references()...)
+	}
+	for _, field := range n.fields {
+		refs = append(refs, field.node.references()...)
+	}
+	return refs
+}
+
+// BuildJSONSchema returns a JSON Schema document with a definition for every struct and named type
+// reachable from the exposed values, to validate untrusted data before passing it to Go
+func (e *Exposer) BuildJSONSchema() (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	builder := e.schemaBuilder()
+
+	definitions := make(map[string]interface{})
+	for name, definition := range builder.definitions {
+		node, err := builder.definition(definition)
+		if err != nil {
+			return "", err
+		}
+		definitions[name] = node.jsonSchema()
+	}
+
+	document, err := json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs":   definitions,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed writing the schema: %w", err)
+	}
+
+	return string(document), nil
+}
+
+func (n *schemaNode) jsonSchema() map[string]interface{} {
+	schema := make(map[string]interface{})
+
+	switch n.kind {
+	case schemaBoolean:
+		schema["type"] = "boolean"
+	case schemaInteger:
+		schema["type"] = "integer"
+		if n.minimum != nil {
+			schema["minimum"] = *n.minimum
+		}
+		if n.maximum != nil {
+			schema["maximum"] = *n.maximum
+		}
+	case schemaNumber:
+		schema["type"] = "number"
+	case schemaString:
+		schema["type"] = "string"
+		if n.minLength != nil {
+			schema["minLength"] = *n.minLength
+		}
+		if n.maxLength != nil {
+			schema["maxLength"] = *n.maxLength
+		}
+		if n.pattern != "" {
+			schema["pattern"] = n.pattern
+		}
+	case schemaBytes:
+		schema["anyOf"] = []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": math.MaxUint8}},
+		}
+	case schemaArray:
+		schema["type"] = "array"
+		schema["items"] = n.items.jsonSchema()
+		if n.length >= 0 {
+			schema["minItems"] = n.length
+			schema["maxItems"] = n.length
+		}
+		if n.minLength != nil {
+			schema["minItems"] = *n.minLength
+		}
+		if n.maxLength != nil {
+			schema["maxItems"] = *n.maxLength
+		}
+	case schemaRecord:
+		schema["type"] = "object"
+		schema["additionalProperties"] = n.items.jsonSchema()
+		if n.minLength != nil {
+			schema["minProperties"] = *n.minLength
+		}
+		if n.maxLength != nil {
+			schema["maxProperties"] = *n.maxLength
+		}
+	case schemaObject:
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		for _, field := range n.fields {
+			properties[field.name] = field.node.jsonSchema()
+			if field.required {
+				required = append(required, field.name)
+			}
+		}
+
+		schema["type"] = "object"
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case schemaEnum:
+		schema["enum"] = n.values
+	case schemaRef:
+		schema["$ref"] = "#/$defs/" + n.ref
+	case schemaUnknown:
+		return schema
+	}
+
+	if n.nullable {
+		if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+			schema["anyOf"] = append(anyOf, map[string]interface{}{"type": "null"})
+			return schema
+		}
+
+		return map[string]interface{}{
+			"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}},
+		}
+	}
+
+	return schema
+}
+
+// zodWriter writes the definitions as Zod schemas, ordered so each one is declared before it is used
+type zodWriter struct {
+	builder  *schemaBuilder
+	options  *Options
+	declared map[string]bool
+	visiting map[string]bool
+	lazy     map[string]bool
+	out      strings.Builder
+}
+
+// BuildZod returns a TypeScript module exporting a Zod schema for every struct and named type
+// reachable from the exposed values, grouped by namespace like in the typings
+func (e *Exposer) BuildZod() (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	writer := &zodWriter{
+		builder:  e.schemaBuilder(),
+		options:  e.options,
+		declared: make(map[string]bool),
+		visiting: make(map[string]bool),
+		lazy:     make(map[string]bool),
+	}
+
+	writer.out.WriteString("import { z } from " + writer.quote("zod") + ";\n")
+
+	names := SortedKeys(writer.builder.definitions)
+	for _, name := range names {
+		if err := writer.declare(name); err != nil {
+			return "", err
+		}
+	}
+
+	namespaces := make(map[string][]string)
+	for _, name := range names {
+		namespace, member, _ := strings.Cut(name, ".")
+		namespaces[namespace] = append(namespaces[namespace], fmt.Sprintf("%s: %s", member, zodIdentifier(name)))
+	}
+
+	for _, namespace := range SortedKeys(namespaces) {
+		body := strings.Join(namespaces[namespace], ",\n")
+		if e.options.TrailingComma {
+			body += ","
+		}
+		writer.out.WriteString(fmt.Sprintf("\nexport const %s = {\n%s\n};\n", namespace, indent(body)))
+	}
+
+	return writer.out.String(), nil
+}
+
+// declare writes a definition after the ones it refers to. A reference back to a definition
+// still being written is a cycle, which goes through z.lazy and needs an explicit type.
+func (w *zodWriter) declare(name string) error {
+	if w.declared[name] || w.visiting[name] {
+		return nil
+	}
+	w.visiting[name] = true
+
+	node, err := w.builder.definition(w.builder.definitions[name])
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range node.references() {
+		if w.visiting[ref] {
+			w.lazy[ref] = true
+		} else if err := w.declare(ref); err != nil {
+			return err
+		}
+	}
+
+	schema := w.schema(node)
+	delete(w.visiting, name)
+	w.declared[name] = true
+
+	annotation := ""
+	if w.lazy[name] {
+		annotation = ": z.ZodTypeAny"
+	}
+
+	w.out.WriteString(fmt.Sprintf("\nconst %s%s = %s;\n", zodIdentifier(name), annotation, schema))
+	return nil
+}
+
+func (w *zodWriter) schema(n *schemaNode) string {
+	var schema string
+
+	switch n.kind {
+	case schemaBoolean:
+		schema = "z.boolean()"
+	case schemaInteger:
+		schema = "z.number().int()" + zodBounds(n)
+	case schemaNumber:
+		schema = "z.number()" + zodBounds(n)
+	case schemaString:
+		schema = "z.string()" + zodLength(n)
+		if n.pattern != "" {
+			schema += ".regex(new RegExp(" + w.quote(n.pattern) + "))"
+		}
+	case schemaBytes:
+		schema = "z.union([z.string(), z.array(z.number().int().min(0).max(255))])"
+	case schemaArray:
+		schema = "z.array(" + w.schema(n.items) + ")"
+		if n.length >= 0 {
+			schema += fmt.Sprintf(".length(%d)", n.length)
+		}
+		schema += zodLength(n)
+	case schemaRecord:
+		schema = "z.record(z.string(), " + w.schema(n.items) + ")"
+		if n.minLength != nil {
+			schema += fmt.Sprintf(".refine((value) => Object.keys(value).length >= %d)", *n.minLength)
+		}
+		if n.maxLength != nil {
+			schema += fmt.Sprintf(".refine((value) => Object.keys(value).length <= %d)", *n.maxLength)
+		}
+	case schemaObject:
+		if len(n.fields) == 0 {
+			schema = "z.object({})"
+			break
+		}
+
+		fields := make([]string, len(n.fields))
+		for i, field := range n.fields {
+			key := field.name
+			if !jsIdentifier.MatchString(key) {
+				key = w.quote(key)
+			}
+			fields[i] = key + ": " + w.schema(field.node)
+			// Omitted nullable fields are nil too, nullish already allows them
+			if !field.required && w.builder.nilMode != NilAsUndefined {
+				fields[i] += ".optional()"
+			}
+		}
+
+		body := strings.Join(fields, ",\n")
+		if w.options.TrailingComma {
+			body += ","
+		}
+		schema = "z.object({\n" + indent(body) + "\n})"
+	case schemaEnum:
+		schema = w.enum(n.values)
+	case schemaRef:
+		schema = zodIdentifier(n.ref)
+		if !w.declared[n.ref] {
+			schema = "z.lazy(() => " + schema + ")"
+		}
+	default:
+		return "z.unknown()"
+	}
+
+	if n.nullable {
+		if w.builder.nilMode == NilAsUndefined {
+			return schema + ".nullish()"
+		}
+		return schema + ".nullable()"
+	}
+
+	return schema
+}
+
+// quote quotes a string literal of the generated module
+func (w *zodWriter) quote(value string) string {
+	return quoteJS(value, w.options.QuoteStyle)
+}
+
+func zodBounds(n *schemaNode) string {
+	var bounds string
+	if n.minimum != nil {
+		bounds += ".min(" + strconv.FormatFloat(*n.minimum, 'f', -1, 64) + ")"
+	}
+	if n.maximum != nil {
+		bounds += ".max(" + strconv.FormatFloat(*n.maximum, 'f', -1, 64) + ")"
+	}
+	return bounds
+}
+
+func zodLength(n *schemaNode) string {
+	if n.minLength != nil && n.maxLength != nil && *n.minLength == *n.maxLength {
+		return fmt.Sprintf(".length(%d)", *n.minLength)
+	}
+
+	var length string
+	if n.minLength != nil {
+		length += fmt.Sprintf(".min(%d)", *n.minLength)
+	}
+	if n.maxLength != nil {
+		length += fmt.Sprintf(".max(%d)", *n.maxLength)
+	}
+	return length
+}
+
+func (w *zodWriter) enum(values []interface{}) string {
+	literals := make([]string, len(values))
+	allStrings := true
+	for i, value := range values {
+		if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.String {
+			literals[i] = w.quote(reflected.String())
+		} else {
+			literals[i], _ = tsLiteral(reflected)
+			allStrings = false
+		}
+	}
+
+	if allStrings {
+		return "z.enum([" + strings.Join(literals, ", ") + "])"
+	}
+
+	if len(literals) == 1 {
+		return "z.literal(" + literals[0] + ")"
+	}
+
+	for i, literal := range literals {
+		literals[i] = "z.literal(" + literal + ")"
+	}
+	return "z.union([" + strings.Join(literals, ", ") + "])"
+}
+
+func zodIdentifier(name string) string {
+	return strings.ReplaceAll(name, ".", "_")
+}
@@ -0,0 +1,305 @@
+package crystalline
+
+import (
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	packageDirs  = make(map[string]string)
+	packageFiles = make(map[string][]*ast.File)
+	sourceMutex  sync.RWMutex
+)
+
+// rememberPackageDir records the source directory of the package a function belongs to
+func rememberPackageDir(pointer uintptr) {
+	pc := runtime.FuncForPC(pointer)
+	if pc == nil {
+		return
+	}
+
+	filePath, _ := pc.FileLine(pointer)
+	if filePath == "" {
+		return
+	}
+
+	name := pc.Name()
+	if lastSlash := strings.LastIndex(name, "/"); lastSlash >= 0 {
+		name = name[:lastSlash+1] + strings.SplitN(name[lastSlash+1:], ".", 2)[0]
+	} else {
+		name = strings.SplitN(name, ".", 2)[0]
+	}
+
+	// Dots in the last path element are escaped in symbol names
+	name = strings.ReplaceAll(name, "%2e", ".")
+
+	sourceMutex.Lock()
+	defer sourceMutex.Unlock()
+
+	// A package that was not found before may be located from its code now
+	if dir := packageDirs[name]; dir == "" {
+		packageDirs[name] = filepath.Dir(filePath)
+	}
+}
+
+func findPackageDir(typeDef reflect.Type) string {
+	// Methods of interfaces have no code to locate the package from
+	if typeDef.Kind() != reflect.Interface {
+		for i := 0; i < typeDef.NumMethod(); i++ {
+			rememberPackageDir(typeDef.Method(i).Func.Pointer())
+		}
+	}
+
+	sourceMutex.RLock()
+	dir, ok := packageDirs[typeDef.PkgPath()]
+	sourceMutex.RUnlock()
+
+	if ok {
+		return dir
+	}
+
+	// Misses are cached too, looking a package up again would not find it either
+	if pkg, err := build.Import(typeDef.PkgPath(), "", build.FindOnly); err == nil {
+		dir = pkg.Dir
+	}
+
+	sourceMutex.Lock()
+	packageDirs[typeDef.PkgPath()] = dir
+	sourceMutex.Unlock()
+
+	return dir
+}
+
+func parsePackage(dir string, pkgName string) []*ast.File {
+	sourceMutex.RLock()
+	files, ok := packageFiles[dir]
+	sourceMutex.RUnlock()
+
+	if ok {
+		return files
+	}
+
+	// Unreadable directories are cached as packages without files
+	entries, _ := os.ReadDir(dir)
+
+	files = make([]*ast.File, 0)
+	fileSet := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fileSet, filepath.Join(dir, entry.Name()), nil, parser.ParseComments)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+
+		files = append(files, f)
+	}
+
+	sourceMutex.Lock()
+	defer sourceMutex.Unlock()
+
+	// Another goroutine may have parsed the package meanwhile, keep a single copy of the AST
+	if existing, ok := packageFiles[dir]; ok {
+		return existing
+	}
+
+	packageFiles[dir] = files
+	return files
+}
+
+// findTypeSpec returns the declaration of a named type from its package source
+func findTypeSpec(typeDef reflect.Type) (*ast.GenDecl, *ast.TypeSpec) {
+	if typeDef.Name() == "" || typeDef.PkgPath() == "" {
+		return nil, nil
+	}
+
+	dir := findPackageDir(typeDef)
+	if dir == "" {
+		return nil, nil
+	}
+
+	typeName, _, _ := strings.Cut(typeDef.Name(), "[")
+	for _, f := range parsePackage(dir, path.Base(typeDef.PkgPath())) {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if typeSpec.Name.Name == typeName {
+					return genDecl, typeSpec
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// findInterfaceMethods returns the signatures of the methods declared by an interface
+func findInterfaceMethods(typeDef reflect.Type) map[string]*ast.FuncType {
+	methods := make(map[string]*ast.FuncType)
+
+	_, typeSpec := findTypeSpec(typeDef)
+	if typeSpec == nil {
+		return methods
+	}
+
+	interfaceType, ok := typeSpec.Type.(*ast.InterfaceType)
+	if !ok {
+		return methods
+	}
+
+	for _, field := range interfaceType.Methods.List {
+		if funcType, ok := field.Type.(*ast.FuncType); ok {
+			for _, name := range field.Names {
+				methods[name.Name] = funcType
+			}
+		}
+	}
+
+	return methods
+}
+
+// findEnumValues returns the constants declared with a named type
+func findEnumValues(typeDef reflect.Type) []EnumValue {
+	dir := findPackageDir(typeDef)
+	if dir == "" {
+		return nil
+	}
+
+	typeName, _, _ := strings.Cut(typeDef.Name(), "[")
+
+	values := make([]EnumValue, 0)
+	for _, f := range parsePackage(dir, path.Base(typeDef.PkgPath())) {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.CONST {
+				continue
+			}
+
+			values = append(values, constBlockValues(genDecl, typeName)...)
+		}
+	}
+
+	return values
+}
+
+func constBlockValues(genDecl *ast.GenDecl, typeName string) []EnumValue {
+	values := make([]EnumValue, 0)
+	known := make(map[string]constant.Value)
+
+	var lastType ast.Expr
+	var lastValues []ast.Expr
+	for iota, spec := range genDecl.Specs {
+		valueSpec := spec.(*ast.ValueSpec)
+
+		// A spec without a type and values repeats the previous one with the next iota
+		if valueSpec.Type != nil || len(valueSpec.Values) > 0 {
+			lastType = valueSpec.Type
+			lastValues = valueSpec.Values
+		}
+
+		for i, name := range valueSpec.Names {
+			if i >= len(lastValues) {
+				continue
+			}
+
+			value := evaluateConst(lastValues[i], int64(iota), known)
+			if value == nil {
+				continue
+			}
+
+			known[name.Name] = value
+
+			typeIdent, ok := lastType.(*ast.Ident)
+			if !ok {
+				if call, isCall := lastValues[i].(*ast.CallExpr); isCall && lastType == nil {
+					typeIdent, ok = call.Fun.(*ast.Ident)
+				}
+			}
+
+			if ok && typeIdent.Name == typeName && name.Name != "_" {
+				values = append(values, EnumValue{
+					Name:  name.Name,
+					Value: value,
+				})
+			}
+		}
+	}
+
+	return values
+}
+
+func evaluateConst(expr ast.Expr, iota int64, known map[string]constant.Value) constant.Value {
+	switch castExpr := expr.(type) {
+	case *ast.BasicLit:
+		value := constant.MakeFromLiteral(castExpr.Value, castExpr.Kind, 0)
+		if value.Kind() == constant.Unknown {
+			return nil
+		}
+		return value
+	case *ast.Ident:
+		switch castExpr.Name {
+		case "iota":
+			return constant.MakeInt64(iota)
+		case "true":
+			return constant.MakeBool(true)
+		case "false":
+			return constant.MakeBool(false)
+		}
+		return known[castExpr.Name]
+	case *ast.ParenExpr:
+		return evaluateConst(castExpr.X, iota, known)
+	case *ast.CallExpr:
+		// Conversions such as Status("active")
+		if len(castExpr.Args) != 1 {
+			return nil
+		}
+		return evaluateConst(castExpr.Args[0], iota, known)
+	case *ast.UnaryExpr:
+		value := evaluateConst(castExpr.X, iota, known)
+		if value == nil {
+			return nil
+		}
+		return constant.UnaryOp(castExpr.Op, value, 0)
+	case *ast.BinaryExpr:
+		left := evaluateConst(castExpr.X, iota, known)
+		right := evaluateConst(castExpr.Y, iota, known)
+		if left == nil || right == nil {
+			return nil
+		}
+
+		switch castExpr.Op {
+		case token.SHL, token.SHR:
+			shift, ok := constant.Uint64Val(right)
+			if !ok {
+				return nil
+			}
+			return constant.Shift(left, castExpr.Op, uint(shift))
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return constant.MakeBool(constant.Compare(left, castExpr.Op, right))
+		case token.QUO:
+			if left.Kind() == constant.Int && right.Kind() == constant.Int {
+				return constant.BinaryOp(left, token.QUO_ASSIGN, right)
+			}
+		}
+		return constant.BinaryOp(left, castExpr.Op, right)
+	}
+
+	return nil
+}
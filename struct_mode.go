@@ -0,0 +1,144 @@
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// StructMode controls whether a struct is mapped to JS as a live proxy or as a snapshot copy
+type StructMode int
+
+const (
+	// StructModeAuto maps addressable structs as live proxies and everything else as snapshots
+	StructModeAuto StructMode = iota
+
+	// StructModeLive maps structs as getter/setter proxies that read and write the Go value.
+	// Values that are not addressable, like the results of functions, are copies and map as snapshots.
+	StructModeLive
+
+	// StructModeSnapshot maps structs as plain objects copied at mapping time
+	StructModeSnapshot
+)
+
+// mapSettings carries the struct mode requested for the value being mapped,
+// and the exposer defaults used for struct fields without a tag.
+type mapSettings struct {
+	structMode  StructMode
+	defaultMode StructMode
+	view        bool
+	defaultView bool
+	nilMode     NilMode
+	throws      bool
+	strict      bool
+	options     *Options
+
+	// visiting holds the pointers, maps and slices being mapped by the current snapshot, to detect cycles
+	visiting map[visitKey]bool
+}
+
+type visitKey struct {
+	pointer uintptr
+	typeDef reflect.Type
+	length  int
+}
+
+func (s mapSettings) resolve(typeDef reflect.Type) StructMode {
+	if s.options != nil && s.options.Worker {
+		return StructModeSnapshot
+	}
+
+	if s.structMode != StructModeAuto {
+		return s.structMode
+	}
+
+	if typeDef.Kind() == reflect.Struct {
+		if mode, ok := s.opts().structMode(typeDef.String()); ok {
+			return mode
+		}
+	}
+
+	return s.defaultMode
+}
+
+func (s mapSettings) isLive(typeDef reflect.Type, addressable bool) bool {
+	switch s.resolve(typeDef) {
+	case StructModeLive:
+		return true
+	case StructModeSnapshot:
+		return false
+	}
+	return addressable
+}
+
+func (s mapSettings) field(field reflect.StructField) mapSettings {
+	mode := StructModeAuto
+	if hasTagOption(field, "live") {
+		mode = StructModeLive
+	} else if hasTagOption(field, "snapshot") {
+		mode = StructModeSnapshot
+	}
+
+	// Live collections are proxies, which cannot be sent from a worker
+	if s.options != nil && s.options.Worker {
+		mode = StructModeAuto
+	}
+
+	return mapSettings{
+		structMode:  mode,
+		defaultMode: s.defaultMode,
+		view:        hasTagOption(field, "view"),
+		defaultView: s.defaultView,
+		nilMode:     s.nilMode,
+		options:     s.options,
+		visiting:    s.visiting,
+	}
+}
+
+func (s mapSettings) nested() mapSettings {
+	return mapSettings{
+		defaultMode: s.defaultMode,
+		defaultView: s.defaultView,
+		nilMode:     s.nilMode,
+		options:     s.options,
+	}
+}
+
+// visit marks a reference as being mapped, failing if it is already being mapped further up the graph.
+// The returned func must be called once the reference is mapped.
+func (s *mapSettings) visit(value reflect.Value) (func(), error) {
+	key := visitKey{
+		pointer: value.Pointer(),
+		typeDef: value.Type(),
+	}
+
+	if value.Kind() == reflect.Slice {
+		key.length = value.Len()
+	}
+
+	if s.visiting == nil {
+		s.visiting = make(map[visitKey]bool)
+	}
+
+	if s.visiting[key] {
+		return nil, fmt.Errorf("cyclic reference to %s cannot be mapped, use a live struct to expose it", value.Type().String())
+	}
+
+	s.visiting[key] = true
+	visiting := s.visiting
+	return func() {
+		delete(visiting, key)
+	}, nil
+}
+
+// opts returns the exposer options, falling back to the globals for the package level mappers
+func (s mapSettings) opts() *Options {
+	if s.options == nil {
+		return globalOptions()
+	}
+	return s.options
+}
+
+// views reports whether numeric slices should be mapped as typed array views over the wasm memory
+func (s mapSettings) views() bool {
+	return s.view || s.defaultView
+}
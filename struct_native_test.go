@@ -0,0 +1,8 @@
+//go:build !js
+
+package crystalline
+
+// snapshotString reads a string field of a mapped snapshot struct
+func snapshotString(result interface{}, key string) string {
+	return result.(map[string]interface{})[key].(string)
+}
@@ -3,8 +3,12 @@
 package crystalline
 
 import (
+	"reflect"
+	"runtime"
+	"sync"
 	"syscall/js"
 	"testing"
+	"time"
 
 	"github.com/MarvinJWendt/testza"
 )
@@ -35,3 +39,349 @@ func TestStructNoPointers(t *testing.T) {
 
 	testza.AssertEqual(t, "hello", obj.FirstValue)
 }
+
+func TestStructModes(t *testing.T) {
+	obj := &ModeObj{
+		Auto:     ModeItem{Value: "auto"},
+		Live:     ModeItem{Value: "live"},
+		Snapshot: &ModeItem{Value: "snapshot"},
+		Items:    []ModeItem{{Value: "item"}},
+	}
+
+	js.Global().Set("TestModes", MapOrPanic(obj))
+
+	js.Global().Get("eval").Invoke(`global.TestModes.Auto.Value = 'changed';
+global.TestModes.Live.Value = 'changed';
+global.TestModes.Snapshot.Value = 'changed';
+global.TestModes.Items[0].Value = 'changed';`)
+
+	testza.AssertEqual(t, "auto", obj.Auto.Value)
+	testza.AssertEqual(t, "changed", obj.Live.Value)
+	testza.AssertEqual(t, "snapshot", obj.Snapshot.Value)
+	testza.AssertEqual(t, "changed", obj.Items[0].Value)
+	testza.AssertTrue(t, js.Global().Get("TestModes").Get("Live").Get("__live").Bool())
+
+	// Copies would not be written back, so they are mapped as snapshots even in live mode
+	live := mapSettings{defaultMode: StructModeLive}
+	result, err := mapInternal(reflect.ValueOf(ModeItem{Value: "copy"}), false, false, live)
+	testza.AssertNoError(t, err)
+	testza.AssertTrue(t, result.(js.Value).Get("__live").IsUndefined())
+	testza.AssertEqual(t, "copy", result.(js.Value).Get("Value").String())
+
+	result, err = mapInternal(reflect.ValueOf(&ModeItem{Value: "pointer"}), false, false, live)
+	testza.AssertNoError(t, err)
+	testza.AssertTrue(t, result.(js.Value).Get("__live").Bool())
+
+	snapshot := mapSettings{defaultMode: StructModeSnapshot}
+	result, err = mapInternal(reflect.ValueOf(obj), false, false, snapshot)
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, "auto", result.(js.Value).Get("Auto").Get("Value").String())
+	testza.AssertTrue(t, result.(js.Value).Get("Live").Get("__live").Bool())
+}
+
+func TestLiveCollections(t *testing.T) {
+	obj := &ModeObj{
+		Items:  []ModeItem{{Value: "first"}},
+		Lookup: map[string]int{"a": 1},
+	}
+
+	js.Global().Set("TestCollections", MapOrPanic(obj))
+
+	js.Global().Get("eval").Invoke(`global.TestCollections.Items.push({ Value: 'second' });
+global.TestCollections.Items[2] = { Value: 'third' };
+global.TestCollections.Lookup.b = 2;
+delete global.TestCollections.Lookup.a;`)
+
+	testza.AssertEqual(t, []ModeItem{{Value: "first"}, {Value: "second"}, {Value: "third"}}, obj.Items)
+	testza.AssertEqual(t, map[string]int{"b": 2}, obj.Lookup)
+
+	obj.Items = obj.Items[:1]
+	items := js.Global().Get("TestCollections").Get("Items")
+	testza.AssertEqual(t, 1, items.Get("length").Int())
+	testza.AssertTrue(t, js.Global().Get("Array").Call("isArray", items).Bool())
+	testza.AssertEqual(t, "first", items.Call("map", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		return args[0].Get("Value")
+	})).Index(0).String())
+
+	js.Global().Get("eval").Invoke(`global.TestCollections.Items.length = 0;`)
+	testza.AssertEqual(t, 0, len(obj.Items))
+
+	keys := js.Global().Get("Object").Call("keys", js.Global().Get("TestCollections").Get("Lookup"))
+	testza.AssertEqual(t, 1, keys.Length())
+	testza.AssertEqual(t, "b", keys.Index(0).String())
+
+	// Collections of copied structs would not be written back, so they are mapped as snapshots
+	copied := MapOrPanic(ModeObj{Items: []ModeItem{{Value: "copy"}}, Lookup: map[string]int{"a": 1}}).(js.Value)
+	testza.AssertTrue(t, copied.Get("Items").Get("__live").IsUndefined())
+	testza.AssertTrue(t, copied.Get("Lookup").Get("__live").IsUndefined())
+	testza.AssertEqual(t, "copy", copied.Get("Items").Get("0").Get("Value").String())
+	testza.AssertEqual(t, 1, copied.Get("Lookup").Get("a").Int())
+}
+
+func TestLiveCollectionsRejectedValues(t *testing.T) {
+	obj := &ModeObj{
+		Items:  []ModeItem{{Value: "first"}},
+		Lookup: map[string]int{"a": 1},
+	}
+
+	js.Global().Set("TestRejected", MapOrPanic(obj))
+
+	assign := func(script string) (string, string) {
+		name := js.Global().Get("eval").Invoke(`(() => {
+  "use strict";
+  try {
+    ` + script + `;
+    return "";
+  } catch (error) {
+    return error.name;
+  }
+})()`).String()
+		thrown := js.Global().Get("goInternalError")
+		js.Global().Set("goInternalError", js.Undefined())
+		if thrown.IsUndefined() {
+			return name, ""
+		}
+		return name, thrown.String()
+	}
+
+	name, thrown := assign(`global.TestRejected.Lookup.b = "two"`)
+	testza.AssertEqual(t, "TypeError", name)
+	testza.AssertContains(t, thrown, "failed parsing string to int")
+	testza.AssertEqual(t, map[string]int{"a": 1}, obj.Lookup)
+
+	name, thrown = assign(`global.TestRejected.Items[3] = 5`)
+	testza.AssertEqual(t, "TypeError", name)
+	testza.AssertContains(t, thrown, "call of Value.Get on number")
+	testza.AssertEqual(t, []ModeItem{{Value: "first"}}, obj.Items)
+
+	name, _ = assign(`global.TestRejected.Items.length = "many"`)
+	testza.AssertEqual(t, "TypeError", name)
+	testza.AssertEqual(t, 1, len(obj.Items))
+
+	name, thrown = assign(`global.TestRejected.Lookup.b = 2`)
+	testza.AssertEqual(t, "", name)
+	testza.AssertEqual(t, "", thrown)
+	testza.AssertEqual(t, map[string]int{"a": 1, "b": 2}, obj.Lookup)
+}
+
+func TestLiveCollectionsConcurrent(t *testing.T) {
+	type concurrentItems []string
+	type concurrentLookup map[string]int
+
+	live := mapSettings{structMode: StructModeLive}
+
+	var wg sync.WaitGroup
+	results := make([]js.Value, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var result interface{}
+			if i%2 == 0 {
+				result, _ = mapInternal(reflect.ValueOf(&concurrentItems{"a", "b"}).Elem(), false, false, live)
+			} else {
+				result, _ = mapInternal(reflect.ValueOf(&concurrentLookup{"a": 1, "b": 2}).Elem(), false, false, live)
+			}
+
+			results[i] = result.(js.Value)
+		}(i)
+	}
+	wg.Wait()
+
+	// Proxies are read through Get, as Index does not survive the stack moving while a trap runs Go code
+	for i, result := range results {
+		testza.AssertTrue(t, result.Get("__live").Bool())
+		if i%2 == 0 {
+			testza.AssertEqual(t, "b", result.Get("1").String())
+		} else {
+			testza.AssertEqual(t, 2, result.Get("b").Int())
+		}
+	}
+}
+
+func TestStructNilMode(t *testing.T) {
+	undefined := mapSettings{nilMode: NilAsUndefined}
+
+	result, err := mapInternal(reflect.ValueOf(NilObj{}), false, false, undefined)
+	testza.AssertNoError(t, err)
+	testza.AssertTrue(t, result.(js.Value).Get("Pointer").IsUndefined())
+	testza.AssertTrue(t, result.(js.Value).Get("Optional").IsUndefined())
+	testza.AssertEqual(t, 0, result.(js.Value).Get("Required").Length())
+
+	live := MapOrPanic(&NilObj{}).(js.Value)
+	testza.AssertTrue(t, live.Get("Pointer").IsNull())
+	testza.AssertEqual(t, 0, live.Get("Required").Get("length").Int())
+
+	js.Global().Set("TestNotNil", MapOrPanic(func(obj NilObj) bool {
+		return obj.Required != nil && obj.Optional == nil
+	}))
+	testza.AssertTrue(t, Run([]interface{}{"TestNotNil"}, map[string]interface{}{}).Bool())
+}
+
+func TestStructDirectives(t *testing.T) {
+	obj := &DirectiveObj{ID: "a", Secret: "hidden", Visible: 1}
+	js.Global().Set("TestDirectiveObj", MapOrPanic(obj))
+
+	value := js.Global().Get("TestDirectiveObj")
+	testza.AssertEqual(t, "a", value.Get("id").String())
+	testza.AssertTrue(t, value.Get("ID").IsUndefined())
+	testza.AssertTrue(t, value.Get("Secret").IsUndefined())
+	testza.AssertTrue(t, value.Get("Internal").IsUndefined())
+	testza.AssertEqual(t, "a:b", value.Call("fetch", "b").String())
+
+	thrown := js.Global().Get("eval").Invoke(`(() => {
+	try {
+		TestDirectiveObj.fetch("");
+	} catch (e) {
+		return e.message;
+	}
+})()`)
+	testza.AssertEqual(t, "empty key", thrown.String())
+
+	js.Global().Set("TestDirectiveInput", MapOrPanic(func(obj DirectiveObj) string {
+		return obj.ID + obj.Secret
+	}))
+	testza.AssertEqual(t, "b", Run([]interface{}{"TestDirectiveInput"}, map[string]interface{}{"id": "b", "Secret": "ignored"}).String())
+}
+
+type CycleNode struct {
+	Name  string
+	Next  *CycleNode
+	Left  *CycleNode
+	Right *CycleNode
+}
+
+func TestStructCycles(t *testing.T) {
+	snapshot := mapSettings{defaultMode: StructModeSnapshot}
+
+	a := &CycleNode{Name: "a"}
+	b := &CycleNode{Name: "b", Next: a}
+	a.Next = b
+
+	_, err := mapInternal(reflect.ValueOf(a), false, false, snapshot)
+	testza.AssertNotNil(t, err)
+	testza.AssertContains(t, err.Error(), "cyclic reference to *crystalline.CycleNode")
+
+	leaf := &CycleNode{Name: "leaf"}
+	shared := &CycleNode{Name: "root", Left: leaf, Right: leaf}
+	result, err := mapInternal(reflect.ValueOf(shared), false, false, snapshot)
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, "leaf", result.(js.Value).Get("Right").Get("Name").String())
+
+	self := map[string]interface{}{}
+	self["self"] = self
+	_, err = mapInternal(reflect.ValueOf(self), false, false, snapshot)
+	testza.AssertNotNil(t, err)
+
+	js.Global().Set("TestCycles", MapOrPanic(a))
+	testza.AssertEqual(t, "a", js.Global().Get("TestCycles").Get("Next").Get("Next").Get("Name").String())
+}
+
+func TestStructSnapshotOrder(t *testing.T) {
+	snapshot := mapSettings{defaultMode: StructModeSnapshot}
+
+	for i := 0; i < 10; i++ {
+		result, err := mapInternal(reflect.ValueOf(CycleNode{Name: "leaf"}), false, false, snapshot)
+		testza.AssertNoError(t, err)
+		testza.AssertEqual(t, `{"Name":"leaf","Next":null,"Left":null,"Right":null}`, js.Global().Get("JSON").Call("stringify", result).String())
+	}
+}
+
+func TestStructObservable(t *testing.T) {
+	state := &CounterState{Label: "clicks"}
+	js.Global().Set("TestObservable", MapOrPanic(state))
+
+	js.Global().Get("eval").Invoke(`(() => {
+	globalThis.observed = [];
+	const unsubscribe = global.TestObservable.subscribe((value, field) => globalThis.observed.push(field + "=" + value.Count));
+	globalThis.stopObserving = unsubscribe;
+	global.TestObservable.Count = 2;
+	global.TestObservable.Increment();
+})()`)
+
+	state.Count = 10
+	Notify(state, "Count")
+
+	js.Global().Call("stopObserving")
+	Notify(state, "Label")
+
+	observed := js.Global().Get("observed")
+	testza.AssertEqual(t, 4, observed.Length())
+	testza.AssertEqual(t, "undefined=0", observed.Index(0).String())
+	testza.AssertEqual(t, "Count=2", observed.Index(1).String())
+	testza.AssertEqual(t, "Count=3", observed.Index(2).String())
+	testza.AssertEqual(t, "Count=10", observed.Index(3).String())
+	testza.AssertFalse(t, js.Global().Get("TestObservable").Call("hasOwnProperty", "Observable").Bool())
+
+	// Subscribed objects survive the weak cache dropping them, so mapping the value again keeps them
+	js.Global().Get("eval").Invoke(`globalThis.stopObserving = global.TestObservable.subscribe(() => {})`)
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+	testza.AssertTrue(t, js.Global().Get("TestObservable").Equal(MapOrPanic(state).(js.Value)))
+	js.Global().Call("stopObserving")
+	js.Global().Call("stopObserving")
+
+	// Each subscription is cancelled on its own, even when the same run subscribed twice
+	js.Global().Get("eval").Invoke(`(() => {
+	globalThis.twiceObserved = 0;
+	const run = () => globalThis.twiceObserved++;
+	const first = global.TestObservable.subscribe(run);
+	globalThis.stopObserving = global.TestObservable.subscribe(run);
+	first();
+	first();
+})()`)
+	Notify(state, "Count")
+	testza.AssertEqual(t, 3, js.Global().Get("twiceObserved").Int())
+	js.Global().Call("stopObserving")
+	Notify(state, "Count")
+	testza.AssertEqual(t, 3, js.Global().Get("twiceObserved").Int())
+
+	thrown := js.Global().Get("eval").Invoke(`(() => {
+	try {
+		global.TestObservable.subscribe("run");
+	} catch (e) {
+		return e instanceof TypeError ? e.message : "not a TypeError";
+	}
+	return "nothing thrown";
+})()`)
+	testza.AssertEqual(t, "expected a subscriber function", thrown.String())
+}
+
+func TestStructSetterValidation(t *testing.T) {
+	form := &SignupForm{Name: "ann", Age: 20}
+	js.Global().Set("TestSetters", MapOrPanic(form))
+
+	assign := func(script string) string {
+		js.Global().Get("eval").Invoke(script)
+		thrown := js.Global().Get("goInternalError")
+		js.Global().Set("goInternalError", js.Undefined())
+		if thrown.IsUndefined() {
+			return ""
+		}
+		return thrown.String()
+	}
+
+	testza.AssertEqual(t, "", assign(`global.TestSetters.Name = "bob"`))
+	testza.AssertEqual(t, "Name: length must be at least 2, got 1", assign(`global.TestSetters.Name = "b"`))
+	testza.AssertEqual(t, "bob", form.Name)
+
+	// Without strict mode mismatched values are converted like arguments
+	testza.AssertEqual(t, "", assign(`global.TestSetters.Tags = null`))
+	testza.AssertEqual(t, []string{}, form.Tags)
+
+	form = &SignupForm{Name: "ann", Age: 20}
+	strict, err := mapInternal(reflect.ValueOf(form), false, false, mapSettings{options: &Options{Strict: true}})
+	testza.AssertNoError(t, err)
+	js.Global().Set("TestStrictSetters", strict)
+
+	testza.AssertEqual(t, "Age: expected integer, got string", assign(`global.TestStrictSetters.Age = "30"`))
+	testza.AssertEqual(t, "Tags: is required", assign(`global.TestStrictSetters.Tags = null`))
+	testza.AssertEqual(t, "", assign(`global.TestStrictSetters.Age = 30`))
+	testza.AssertEqual(t, uint8(30), form.Age)
+}
+
+// snapshotString reads a string field of a mapped snapshot struct
+func snapshotString(result interface{}, key string) string {
+	return result.(js.Value).Get(key).String()
+}
@@ -3,76 +3,119 @@
 package crystalline
 
 import (
+	"fmt"
 	"reflect"
-	"strings"
+	"sync"
 	"syscall/js"
 )
 
 var defineProperties js.Value
 
-var weakCache *WeakCache[js.Value]
+// weakCaches are split per type, as a struct and its first field share the same address
+var (
+	weakCaches      map[reflect.Type]*WeakCache[js.Value]
+	weakCachesMutex sync.Mutex
+)
 
 func init() {
 	defineProperties = js.Global().Get("Object").Get("defineProperties")
-	weakCache = NewWeak[js.Value]()
+	weakCaches = make(map[reflect.Type]*WeakCache[js.Value])
 }
 
-func convertStruct(value reflect.Value) (interface{}, error) {
-	return weakCache.Fetch(value.UnsafeAddr(), func() (js.Value, error) {
-		definitions := make(map[string]interface{})
+// weakCacheFor returns the cache of live values of a type, creating it on first use
+func weakCacheFor(typeDef reflect.Type) *WeakCache[js.Value] {
+	weakCachesMutex.Lock()
+	defer weakCachesMutex.Unlock()
+
+	weakCache, ok := weakCaches[typeDef]
+	if !ok {
+		weakCache = NewWeak[js.Value]()
+		weakCaches[typeDef] = weakCache
+	}
+	return weakCache
+}
 
-		for i := 0; i < value.NumField(); i++ {
-			structField := value.Type().Field(i)
-			if structField.PkgPath != "" {
-				continue
+func convertStruct(value reflect.Value, settings mapSettings) (interface{}, error) {
+	return weakCacheFor(value.Type()).Fetch(value.UnsafeAddr(), func() (js.Value, error) {
+		observable := isObservable(value.Type())
+		if observable {
+			if object, ok := observedObject(value); ok {
+				return object, nil
 			}
+		}
+
+		definitions := make(map[string]interface{})
+
+		fields, names, err := exposedFields(value.Type())
+		if err != nil {
+			return js.Null(), err
+		}
+
+		directives, err := typeDirectives(value.Type())
+		if err != nil {
+			return js.Null(), err
+		}
+		strict := directives.StrictArgs || settings.opts().Strict
 
+		for n, i := range fields {
+			structField := value.Type().Field(i)
 			field := value.Field(i)
+			fieldSettings := settings.field(structField)
+			notNil := hasTagOption(structField, "not_nil")
 
 			getFunc := js.FuncOf(func(this js.Value, args []js.Value) any {
-				return MapOrPanic(field.Interface())
+				fieldValue := field
+				if fieldSettings.resolve(field.Type()) == StructModeAuto {
+					fieldValue = reflect.ValueOf(field.Interface())
+				}
+
+				result, err := mapInternal(fieldValue, false, notNil, fieldSettings)
+				if err != nil {
+					panic(fmt.Errorf("failed internal mapping: %w", err))
+				}
+				return result
 			})
 
-			conv, err := jsToGo(field.Type())
+			setter, err := jsFieldToGo(structField, names[n], strict, settings)
 			if err != nil {
 				return js.Null(), err
 			}
 
+			name := names[n]
 			setFunc := js.FuncOf(func(this js.Value, args []js.Value) any {
-				if conv != nil {
-					field.Set(conv(args[0]))
+				if setter == nil {
+					return nil
+				}
+
+				// Setters cannot return an error, so rejected values are reported like failed calls
+				defer func() {
+					if err := recover(); err != nil {
+						js.Global().Set("goInternalError", fmt.Sprint(err))
+					}
+				}()
+
+				// The value is only assigned once it passed every check
+				converted := reflect.New(field.Type()).Elem()
+				setter(args[0], converted)
+				field.Set(converted)
+
+				if observable {
+					notifyObservers(value, name)
 				}
 				return nil
 			})
 
-			fieldName := structField.Name
-			definitions[fieldName] = js.ValueOf(map[string]interface{}{
+			definitions[names[n]] = js.ValueOf(map[string]interface{}{
 				"get": getFunc,
 				"set": setFunc,
 			})
 		}
 
-		out := make(map[string]interface{})
-
-		promiseFuncs := make(map[string]bool)
-		for i := 0; i < value.NumMethod(); i++ {
-			method := value.Type().Method(i)
-			if method.PkgPath != "" {
-				continue
-			}
+		definitions["__live"] = js.ValueOf(map[string]interface{}{
+			"value": true,
+		})
 
-			fn := findFunction(method.Func.Pointer())
-			if fn != nil && fn.Doc != nil {
-				for _, comment := range fn.Doc.List {
-					if comment != nil {
-						if strings.Contains(comment.Text, "crystalline:promise") {
-							name := method.Name
-							promiseFuncs[name] = true
-						}
-					}
-				}
-			}
-		}
+		out := make(map[string]interface{})
 
 		addr := value.Addr()
 		for i := 0; i < addr.NumMethod(); i++ {
@@ -81,45 +124,44 @@ func convertStruct(value reflect.Value) (interface{}, error) {
 				continue
 			}
 
-			name := method.Name
-			promise := promiseFuncs[name]
-
-			if inner, ok := ignored[value.Type().String()]; ok {
-				if inner[name] {
-					continue
-				}
+			directives, err := methodDirectives(value.Type(), method.Name, settings.opts())
+			if err != nil {
+				return js.Null(), err
 			}
 
-			if !promise {
-				fn := findFunction(method.Func.Pointer())
-				if fn != nil && fn.Doc != nil {
-					for _, comment := range fn.Doc.List {
-						if comment != nil {
-							if strings.Contains(comment.Text, "crystalline:promise") {
-								promise = true
-							}
-						}
-					}
-				}
+			if directives.Ignore {
+				continue
 			}
 
-			if !promise {
-				if inner, ok := promisified[value.Type().String()]; ok {
-					promise = inner[name]
-				}
-			}
+			methodSettings := settings
+			methodSettings.throws = directives.Throws
+			methodSettings.strict = directives.StrictArgs
 
-			val, err := mapInternal(addr.Method(i), promise, false)
+			val, err := mapInternal(addr.Method(i), directives.Promise, false, methodSettings)
 			if err != nil {
 				return js.Null(), err
 			}
-			out[name] = val
+			out[directives.jsName(method.Name)] = val
+		}
+
+		var obj js.Value
+		if observable {
+			out["subscribe"] = subscribeFunc(value, &obj)
 		}
 
-		obj := js.ValueOf(out)
+		obj = js.ValueOf(out)
 
 		defineProperties.Invoke(obj, definitions)
 
 		return obj, nil
 	})
 }
+
+// snapshotObject builds the object of a snapshot struct, keeping the declaration order of its keys
+func snapshotObject(keys []string, values map[string]interface{}) interface{} {
+	object := js.Global().Get("Object").New()
+	for _, key := range keys {
+		object.Set(key, values[key])
+	}
+	return object
+}
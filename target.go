@@ -0,0 +1,160 @@
+package crystalline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Target selects the module format of the generated JS glue
+type Target int
+
+const (
+	// TargetESM writes an ES module with live exported bindings
+	TargetESM Target = iota
+
+	// TargetCommonJS writes a CommonJS module
+	TargetCommonJS
+
+	// TargetUMD writes a script that works as an AMD or CommonJS module,
+	// and exposes a global named after the app when loaded with a script tag
+	TargetUMD
+
+	// TargetNode writes a CommonJS module that loads wasm_exec.js and instantiates the wasm binary itself
+	TargetNode
+)
+
+// declaration returns the statement declaring an exposed binding
+func (t Target) declaration(name string) string {
+	if t == TargetESM {
+		return fmt.Sprintf("export let %s;\n", name)
+	}
+	return fmt.Sprintf("let %s;\n", name)
+}
+
+// initializer returns the opening of the initializeCrystalline function
+func (t Target) initializer() string {
+	if t == TargetESM {
+		return "export const initializeCrystalline = () => {\n"
+	}
+	return "const initializeCrystalline = () => {\n"
+}
+
+// exports returns the statement exporting the bindings, which are read through getters
+// as they are only assigned once initializeCrystalline is called
+func (t Target) exports(options *Options, names []string) string {
+	if t == TargetESM {
+		return ""
+	}
+
+	members := make([]string, 0, len(names)+2)
+	for _, name := range names {
+		members = append(members, fmt.Sprintf("  get %s() { return %s; }", name, name))
+	}
+
+	members = append(members, "  initializeCrystalline", "  init")
+
+	if t == TargetNode {
+		members = append(members, "  ready")
+	}
+
+	body := strings.Join(members, ",\n")
+	if options.TrailingComma {
+		body += ","
+	}
+
+	if t == TargetUMD {
+		return "return {\n" + body + "\n};"
+	}
+
+	return "module.exports = {\n" + body + "\n};"
+}
+
+// prelude returns the code written before the wrap helper
+func (t Target) prelude(options *Options) string {
+	if t != TargetNode {
+		return ""
+	}
+
+	return strings.Replace(`"use strict";
+
+globalThis.require ??= require;
+globalThis.fs ??= require("fs");
+globalThis.path ??= require("path");
+globalThis.TextEncoder ??= require("util").TextEncoder;
+globalThis.TextDecoder ??= require("util").TextDecoder;
+globalThis.performance ??= require("perf_hooks").performance;
+globalThis.crypto ??= require("crypto").webcrypto;
+
+`, "\"", options.QuoteStyle, -1) + "require(" + quoteJS(options.WasmExecPath, options.QuoteStyle) + ");\n\n"
+}
+
+// init returns the function that boots the Go runtime and resolves once Go calls Ready.
+// The hook is keyed by the app name, so Ready only resolves the apps of its own binary.
+func (t Target) init(options *Options, appName string) string {
+	declaration := "const init"
+	if t == TargetESM {
+		declaration = "export const init"
+	}
+
+	return fmt.Sprintf(strings.Replace(declaration+` = async (source) => {
+  const go = new Go();
+
+  let module = source;
+  if (typeof source === "string" || source instanceof URL) {
+    const response = await fetch(source);
+    module = await response.arrayBuffer();
+  }
+
+  const instance = module instanceof WebAssembly.Module
+    ? await WebAssembly.instantiate(module, go.importObject)
+    : (await WebAssembly.instantiate(module, go.importObject)).instance;
+
+  await new Promise((resolve, reject) => {
+    (globalThis.goReady ??= {})[%s] = resolve;
+    go.run(instance).then(() => reject(new Error("the Go program exited before calling crystalline.Ready()")));
+  });
+
+  initializeCrystalline();
+};`, "\"", options.QuoteStyle, -1), quoteJS(appName, options.QuoteStyle))
+}
+
+// loader returns the code that starts the wasm binary when the module is loaded
+func (t Target) loader(options *Options) string {
+	if t != TargetNode {
+		return ""
+	}
+
+	return "const ready = init(fs.readFileSync(path.resolve(__dirname, " + quoteJS(options.WasmPath, options.QuoteStyle) + ")));"
+}
+
+// wrapModule wraps the whole glue for targets that need an enclosing scope
+func (t Target) wrapModule(options *Options, appName string, body string) string {
+	if t != TargetUMD {
+		return body
+	}
+
+	header := fmt.Sprintf(strings.Replace(`(function (root, factory) {
+  if (typeof define === "function" && define.amd) {
+    define([], factory);
+  } else if (typeof module === "object" && module.exports) {
+    module.exports = factory();
+  } else {
+    root[%s] = factory();
+  }
+}(typeof self !== "undefined" ? self : this, function () {`, "\"", options.QuoteStyle, -1), quoteJS(appName, options.QuoteStyle))
+
+	return header + "\n" + indent(body) + "\n}));"
+}
+
+// typings returns the declarations the target adds to the typings
+func (t Target) typings(appName string) string {
+	switch t {
+	case TargetUMD:
+		if jsIdentifier.MatchString(appName) && !jsReserved[appName] {
+			return "\nexport as namespace " + appName + ";"
+		}
+	case TargetNode:
+		return "\n/** Resolves once the bundled wasm binary called crystalline.Ready() and the bindings are initialized */\nexport const ready: Promise<void>;"
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package expose
+
+import "time"
+
+// Hello is exposed
+// crystalline:expose
+func Hello(name string) string {
+	return "hello, " + name
+}
+
+// Slow is exposed as a promise
+//
+//crystalline:expose
+//crystalline:promise
+func Slow() int {
+	return 1
+}
+
+// Internal is not exposed
+func Internal() {}
+
+// crystalline:expose
+func Generic[T any](value T) T {
+	return value
+}
+
+type Service struct{}
+
+// crystalline:expose
+func (Service) Method() {}
+
+// Storage is implemented by JS objects
+//
+//crystalline:implement
+type Storage interface {
+	Get(key string) (string, error)
+	Set(key, value string)
+	Keys(prefix string, limit ...int) []string
+	Delete(string) bool
+	Expires(key string) time.Duration
+}
+
+// Hidden is not implemented
+type Hidden interface {
+	Get() string
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/Vilsol/crystalline"
+)
+
+func Add(a int, b int) int {
+	return a + b
+}
+
+// main exposes Add when running as wasm, and writes the glue into the given directory otherwise
+func main() {
+	e := crystalline.NewExposer("app", crystalline.WithTarget(crystalline.TargetNode))
+	e.ExposeFuncOrPanic(Add)
+
+	if runtime.GOOS == "js" {
+		crystalline.Ready()
+		select {}
+	}
+
+	tsdFile, jsFile, err := e.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(os.Args[1], "app.d.ts"), []byte(tsdFile), 0o644); err != nil {
+		panic(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(os.Args[1], "app.js"), []byte(jsFile), 0o644); err != nil {
+		panic(err)
+	}
+}
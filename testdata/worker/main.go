@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/Vilsol/crystalline"
+)
+
+type Point struct {
+	X int
+	Y int
+}
+
+func (p Point) Sum() int {
+	return p.X + p.Y
+}
+
+func Add(a int, b int) int {
+	return a + b
+}
+
+func Bytes(size int) []byte {
+	return make([]byte, size)
+}
+
+func Total(data []byte) int {
+	total := 0
+	for _, b := range data {
+		total += int(b)
+	}
+	return total
+}
+
+func Move(p Point, dx int) Point {
+	return Point{X: p.X + dx, Y: p.Y}
+}
+
+func Fail() error {
+	return errors.New("failed")
+}
+
+// main exposes the functions when running as wasm, and writes the proxy and worker script into the given directory otherwise
+func main() {
+	e := crystalline.NewExposer("app", crystalline.WithWorker(true))
+	e.ExposeFuncOrPanic(Add)
+	e.ExposeFuncOrPanic(Bytes)
+	e.ExposeFuncOrPanic(Total)
+	e.ExposeFuncOrPanic(Move)
+	e.ExposeFuncOrPanic(Fail)
+
+	if runtime.GOOS == "js" {
+		crystalline.Ready()
+		select {}
+	}
+
+	tsdFile, jsFile, err := e.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	workerFile, err := e.BuildWorker()
+	if err != nil {
+		panic(err)
+	}
+
+	for name, content := range map[string]string{"app.d.ts": tsdFile, "app.mjs": jsFile, "worker.js": workerFile} {
+		if err := os.WriteFile(filepath.Join(os.Args[1], name), []byte(content), 0o644); err != nil {
+			panic(err)
+		}
+	}
+}
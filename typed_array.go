@@ -0,0 +1,10 @@
+//go:build !js
+
+package crystalline
+
+import "reflect"
+
+// convertTypedArray is just a placeholder
+func convertTypedArray(_ reflect.Value, _ bool) (interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,93 @@
+//go:build js
+
+package crystalline
+
+import (
+	"reflect"
+	"sync"
+	"syscall/js"
+	"unsafe"
+)
+
+var typedArrayConstructors map[reflect.Kind]js.Value
+
+func init() {
+	typedArrayConstructors = make(map[reflect.Kind]js.Value)
+	for _, kind := range []reflect.Kind{reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Float32, reflect.Float64} {
+		typedArrayConstructors[kind] = js.Global().Get(typedArrayName(kind))
+	}
+}
+
+// memoryProbe is only created once typed array views are used.
+// js.CopyBytesToJS calls set() on the destination with a view over the wasm memory,
+// which is the only way to reach the memory buffer without help from the host.
+var memoryProbe = sync.OnceValue(func() js.Value {
+	probe := uint8ArrayConstructor.New(1)
+	probe.Set("set", js.FuncOf(func(this js.Value, args []js.Value) any {
+		this.Set("memory", args[0].Get("buffer"))
+		return nil
+	}))
+	return probe
+})
+
+func convertTypedArray(value reflect.Value, view bool) (interface{}, error) {
+	constructor := typedArrayConstructors[value.Type().Elem().Kind()]
+
+	if value.Len() == 0 {
+		return constructor.New(0), nil
+	}
+
+	if view && (value.Kind() == reflect.Slice || value.CanAddr()) {
+		return constructor.New(wasmMemory(), int(uintptr(typedArrayPointer(value))), value.Len()), nil
+	}
+
+	if value.Kind() == reflect.Array && !value.CanAddr() {
+		addressable := reflect.New(value.Type()).Elem()
+		addressable.Set(value)
+		value = addressable
+	}
+
+	outArray := constructor.New(value.Len())
+	js.CopyBytesToJS(uint8ArrayConstructor.New(outArray.Get("buffer")), typedArrayBytes(value))
+	return outArray, nil
+}
+
+func typedArrayToGo(hint reflect.Type, data js.Value) (reflect.Value, bool) {
+	constructor, ok := typedArrayConstructors[hint.Elem().Kind()]
+	if !ok || !data.InstanceOf(constructor) {
+		return reflect.Value{}, false
+	}
+
+	var outValue reflect.Value
+	if hint.Kind() == reflect.Slice {
+		outValue = reflect.MakeSlice(hint, data.Length(), data.Length())
+	} else {
+		outValue = reflect.New(hint).Elem()
+	}
+
+	source := uint8ArrayConstructor.New(data.Get("buffer"), data.Get("byteOffset"), data.Get("byteLength"))
+	js.CopyBytesToGo(typedArrayBytes(outValue), source)
+
+	return outValue, true
+}
+
+func typedArrayPointer(value reflect.Value) unsafe.Pointer {
+	if value.Kind() == reflect.Slice {
+		return value.UnsafePointer()
+	}
+	return value.Addr().UnsafePointer()
+}
+
+func typedArrayBytes(value reflect.Value) []byte {
+	if value.Len() == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(typedArrayPointer(value)), value.Len()*int(value.Type().Elem().Size()))
+}
+
+// wasmMemory returns the current wasm memory buffer, which changes whenever the memory grows
+func wasmMemory() js.Value {
+	var probe [1]byte
+	js.CopyBytesToJS(memoryProbe(), probe[:])
+	return memoryProbe().Get("memory")
+}
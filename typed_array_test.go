@@ -0,0 +1,52 @@
+//go:build js
+
+package crystalline
+
+import (
+	"reflect"
+	"syscall/js"
+	"testing"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+func TestTypedArrays(t *testing.T) {
+	result := MapOrPanic([]float32{1.5, 2.5}).(js.Value)
+	testza.AssertTrue(t, result.InstanceOf(js.Global().Get("Float32Array")))
+	testza.AssertEqual(t, 2.5, result.Index(1).Float())
+
+	result = MapOrPanic([3]int16{1, -2, 3}).(js.Value)
+	testza.AssertTrue(t, result.InstanceOf(js.Global().Get("Int16Array")))
+	testza.AssertEqual(t, -2, result.Index(1).Int())
+
+	js.Global().Set("TestTypedArray", MapOrPanic(func(a []float32, b [2]uint16) bool {
+		return a[0] == 1.5 && a[1] == 2.5 && b[0] == 3 && b[1] == 4
+	}))
+	testza.AssertTrue(t, Run([]interface{}{"TestTypedArray"}, MapOrPanic([]float32{1.5, 2.5}), MapOrPanic([2]uint16{3, 4})).Bool())
+	testza.AssertTrue(t, Run([]interface{}{"TestTypedArray"}, []interface{}{1.5, 2.5}, []interface{}{3, 4}).Bool())
+}
+
+func TestTypedArrayViews(t *testing.T) {
+	data := []int32{1, 2, 3}
+
+	result, err := mapInternal(reflect.ValueOf(data), false, false, mapSettings{defaultView: true})
+	testza.AssertNoError(t, err)
+
+	view := result.(js.Value)
+	testza.AssertTrue(t, view.InstanceOf(js.Global().Get("Int32Array")))
+	testza.AssertEqual(t, 3, view.Length())
+
+	data[1] = 20
+	testza.AssertEqual(t, 20, view.Index(1).Int())
+
+	view.SetIndex(2, 30)
+	testza.AssertEqual(t, int32(30), data[2])
+
+	// Views made after the memory grew use the new buffer
+	grown := make([]int32, 16<<20)
+	grown[5] = 7
+
+	result, err = mapInternal(reflect.ValueOf(grown), false, false, mapSettings{defaultView: true})
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, 7, result.(js.Value).Index(5).Int())
+}
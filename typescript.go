@@ -2,43 +2,87 @@ package crystalline
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"go/constant"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
 type FuncMeta struct {
-	ArgNames []string
-	Promise  bool
+	ArgNames    []string
+	Promise     bool
+	Throws      bool
+	Deprecation string
 }
 
 type Definition struct {
 	Name        string
 	Entities    map[string]reflect.Type
 	Definitions map[string]reflect.Type
+	Aliases     map[string]reflect.Type
+	Enums       map[string][]EnumValue
 	Nested      map[string]*Definition
 	FuncMeta    map[string]map[string]*FuncMeta
 	Promises    map[string]bool
 	NotNil      map[string]bool
+	Consts      map[string]string
+	Getters     map[string]bool
 }
 
 var (
-	JSQuoteStyle    = "'"
+	// Deprecated: Use WithQuoteStyle
+	JSQuoteStyle = "'"
+	// Deprecated: Use WithTrailingComma
 	JSTrailingComma = false
 )
 
 func (d *Definition) Serialize(ctx context.Context, appName string, path []string) (string, string, error) {
+	options := getMapSettings(ctx).opts()
 	var tsdFile strings.Builder
 	var jsFile strings.Builder
 
-	subPath := path
+	indentation := strings.Repeat("  ", len(path))
 
+	subPath := path
 	if d.Name != "" {
-		jsFile.WriteString(fmt.Sprintf("%s = {\n", d.Name))
-		tsdFile.WriteString(fmt.Sprintf("export declare namespace %s {\n", d.Name))
-		subPath = append(path, d.Name)
+		subPath = append(append([]string{}, path...), d.Name)
+
+		if len(path) == 0 {
+			jsFile.WriteString(fmt.Sprintf("%s = {\n", d.Name))
+			tsdFile.WriteString(fmt.Sprintf("export declare namespace %s {\n", d.Name))
+		} else {
+			jsFile.WriteString(fmt.Sprintf("%s%s: {\n", indentation, d.Name))
+			tsdFile.WriteString(fmt.Sprintf("%snamespace %s {\n", indentation, d.Name))
+		}
 	}
 
+	var nestedTsdFile strings.Builder
+	nestedJs := make([]string, 0)
+	writtenJs := make(map[string]bool)
+	for _, key := range SortedKeys(d.Nested) {
+		nestedTsd, nestedJsFile, err := d.Nested[key].Serialize(ctx, appName, subPath)
+		if err != nil {
+			return "", "", err
+		}
+
+		nestedTsdFile.WriteString(nestedTsd)
+
+		if len(nestedJsFile) > 0 {
+			nestedJs = append(nestedJs, nestedJsFile)
+			writtenJs[key] = true
+		}
+	}
+
+	// Namespaces below the root are members of their parent object and need separating commas
+	hasNested := len(nestedJs) > 0 && len(subPath) > 0
+
+	aliasTsdFile, aliasJsFile := d.serializeAliases(ctx, subPath, hasNested)
+	tsdFile.WriteString(aliasTsdFile)
+	jsFile.WriteString(aliasJsFile)
+
 	defTsdFile, err := d.serializeDefinitions(ctx, d.Definitions, subPath)
 	if err != nil {
 		return "", "", err
@@ -46,34 +90,31 @@ func (d *Definition) Serialize(ctx context.Context, appName string, path []strin
 
 	tsdFile.WriteString(defTsdFile)
 
-	defTsdFile, defJsFile, err := d.serializeEntities(ctx, d.Entities, subPath, appName)
+	defTsdFile, defJsFile, err := d.serializeEntities(ctx, d.Entities, subPath, appName, hasNested)
 	if err != nil {
 		return "", "", err
 	}
 
 	tsdFile.WriteString(defTsdFile)
 	jsFile.WriteString(defJsFile)
+	tsdFile.WriteString(nestedTsdFile.String())
 
-	hasEntities := len(defJsFile) > 0
-	writtenJs := make(map[string]bool)
-	for _, key := range SortedKeys(d.Nested) {
-		definition := d.Nested[key]
-		defTsdFile, defJsFile, err = definition.Serialize(ctx, appName, subPath)
-		if err != nil {
-			return "", "", err
-		}
-
-		tsdFile.WriteString(defTsdFile)
-		jsFile.WriteString(defJsFile)
-
-		if len(defJsFile) > 0 {
-			writtenJs[key] = true
+	for i, nested := range nestedJs {
+		if len(subPath) > 0 && (options.TrailingComma || i < len(nestedJs)-1) {
+			nested = strings.TrimSuffix(nested, "\n") + ",\n"
 		}
+		jsFile.WriteString(nested)
 	}
 
+	hasEntities := len(aliasJsFile) > 0 || len(defJsFile) > 0
+
 	if d.Name != "" {
-		jsFile.WriteString("};\n")
-		tsdFile.WriteString("}\n")
+		if len(path) == 0 {
+			jsFile.WriteString("};\n")
+		} else {
+			jsFile.WriteString(fmt.Sprintf("%s}\n", indentation))
+		}
+		tsdFile.WriteString(fmt.Sprintf("%s}\n", indentation))
 	}
 
 	if !hasEntities && len(writtenJs) == 0 {
@@ -83,17 +124,15 @@ func (d *Definition) Serialize(ctx context.Context, appName string, path []strin
 	if d.Name == "" {
 		innerJs := jsFile.String()
 
-		jsFile = strings.Builder{}
-		for _, key := range SortedKeys(d.Entities) {
-			jsFile.WriteString(fmt.Sprintf("export let %s;\n", key))
-		}
+		names := append(SortedKeys(d.Entities), SortedKeys(writtenJs)...)
 
-		for _, key := range SortedKeys(writtenJs) {
-			jsFile.WriteString(fmt.Sprintf("export let %s;\n", key))
+		jsFile = strings.Builder{}
+		for _, name := range names {
+			jsFile.WriteString(options.Target.declaration(name))
 		}
 
 		jsFile.WriteString("\n")
-		jsFile.WriteString("export const initializeCrystalline = () => {\n")
+		jsFile.WriteString(options.Target.initializer())
 
 		splitLines := strings.Split(strings.TrimSpace(innerJs), "\n")
 		indented := make([]string, len(splitLines))
@@ -102,20 +141,45 @@ func (d *Definition) Serialize(ctx context.Context, appName string, path []strin
 		}
 		jsFile.WriteString(strings.Join(indented, "\n"))
 
-		jsFile.WriteString("\n};")
+		jsFile.WriteString("\n};\n\n")
+		jsFile.WriteString(options.Target.init(options, appName))
+
+		if loader := options.Target.loader(options); loader != "" {
+			jsFile.WriteString("\n\n" + loader)
+		}
+
+		if exports := options.Target.exports(options, names); exports != "" {
+			jsFile.WriteString("\n\n" + exports)
+		}
 
-		tsdFile.WriteString("export const initializeCrystalline: () => void;")
+		if options.Worker {
+			tsdFile.WriteString("/** Starts the worker hosting the Go runtime, and resolves once Go called crystalline.Ready() */\n")
+			tsdFile.WriteString("export function init(worker: string | URL | Worker): Promise<void>;")
+			return tsdFile.String(), jsFile.String(), nil
+		}
+
+		tsdFile.WriteString("/** Reads the exposed values into the bindings, init calls it once Go is ready */\n")
+		tsdFile.WriteString("export const initializeCrystalline: () => void;\n")
+		tsdFile.WriteString("/** Boots the Go runtime from a URL, the wasm bytes or a compiled module, and resolves once Go called crystalline.Ready() */\n")
+		tsdFile.WriteString("export function init(source: string | URL | BufferSource | WebAssembly.Module): Promise<void>;")
 	}
 
 	return tsdFile.String(), jsFile.String(), nil
 }
 
 func (d *Definition) typeToInterface(ctx context.Context, name string, typeDef reflect.Type) string {
+	if typeDef.Kind() == reflect.Interface {
+		return d.implementedInterface(ctx, name, typeDef)
+	}
+
 	if typeDef.Kind() != reflect.Struct {
 		panic("cannot be converted to interface: " + typeDef.Kind().String())
 	}
 
 	var result strings.Builder
+	if directives, _ := typeDirectives(typeDef); directives.Deprecated {
+		result.WriteString(directives.deprecation() + "\n")
+	}
 	result.WriteString("interface ")
 	result.WriteString(name)
 	result.WriteString(" {\n")
@@ -124,39 +188,82 @@ func (d *Definition) typeToInterface(ctx context.Context, name string, typeDef r
 
 	for i := 0; i < typeDef.NumField(); i++ {
 		field := typeDef.Field(i)
-		if field.PkgPath != "" {
+		if field.PkgPath != "" || (field.Anonymous && field.Type == observableType) {
+			continue
+		}
+
+		directives, _ := fieldDirectives(typeDef, field)
+		if directives.Ignore {
 			continue
 		}
 
-		jsName, optional := d.typeToJSName(withContextStep(interfaceCtx, field.Name), "", field.Type, false, name, false)
+		if deprecation := directives.deprecation(); deprecation != "" {
+			result.WriteString("  " + deprecation + "\n")
+		}
+
+		fieldCtx := withMapSettings(withContextStep(interfaceCtx, field.Name), getMapSettings(ctx).field(field))
+		jsName, nullable := d.typeToJSName(fieldCtx, "", field.Type, false, name, false)
 
 		result.WriteString("  ")
-		result.WriteString(field.Name)
-		if optional {
-			if d.NotNil == nil || !d.NotNil[field.Name] {
-				result.WriteString("?")
-			}
-		}
+		result.WriteString(directives.jsName(field.Name))
 		result.WriteString(": ")
 		result.WriteString(jsName)
+		if nullable && !hasTagOption(field, "not_nil") {
+			result.WriteString(nilUnion(ctx))
+		}
 		result.WriteString(";\n")
 	}
 
+	// Values returned from a worker are structured clones, which cannot carry methods
+	methodCount := reflect.PointerTo(typeDef).NumMethod()
+	if getMapSettings(ctx).opts().Worker {
+		methodCount = 0
+	}
+
 	newInstance := reflect.New(typeDef)
-	for i := 0; i < newInstance.NumMethod(); i++ {
+	for i := 0; i < methodCount; i++ {
 		typeMethod := newInstance.Type().Method(i)
 		if typeMethod.PkgPath != "" {
 			continue
 		}
 
-		if inner, ok := ignored[typeDef.String()]; ok {
-			if inner[typeMethod.Name] {
-				continue
-			}
+		directives, _ := methodDirectives(typeDef, typeMethod.Name, getMapSettings(ctx).opts())
+		if directives.Ignore {
+			continue
 		}
 
+		if deprecation := directives.deprecation(); deprecation != "" {
+			result.WriteString("  " + deprecation + "\n")
+		}
+
+		methodName := directives.jsName(typeMethod.Name)
 		instanceMethod := newInstance.Method(i)
-		jsName, _ := d.typeToJSName(withContextStep(interfaceCtx, typeMethod.Name), typeMethod.Name, instanceMethod.Type(), true, name, false)
+		jsName, _ := d.typeToJSName(withContextStep(interfaceCtx, methodName), methodName, instanceMethod.Type(), true, name, false)
+		result.WriteString("  ")
+		result.WriteString(jsName)
+		result.WriteString(";\n")
+	}
+
+	result.WriteString("}\n")
+	return result.String()
+}
+
+// implementedInterface declares the shape JS objects passed as a Go interface must have.
+// Their methods are callbacks, so a trailing error is reported by throwing.
+func (d *Definition) implementedInterface(ctx context.Context, name string, typeDef reflect.Type) string {
+	var result strings.Builder
+	if directives, _ := typeDirectives(typeDef); directives.Deprecated {
+		result.WriteString(directives.deprecation() + "\n")
+	}
+	result.WriteString("interface ")
+	result.WriteString(name)
+	result.WriteString(" {\n")
+
+	interfaceCtx := withInput(withContextStep(ctx, name))
+
+	for i := 0; i < typeDef.NumMethod(); i++ {
+		method := typeDef.Method(i)
+		jsName, _ := d.typeToJSName(withContextStep(interfaceCtx, method.Name), method.Name, method.Type, true, name, false)
 		result.WriteString("  ")
 		result.WriteString(jsName)
 		result.WriteString(";\n")
@@ -167,6 +274,15 @@ func (d *Definition) typeToInterface(ctx context.Context, name string, typeDef r
 }
 
 func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef reflect.Type, topLevel bool, interfaceName string, returnsPromise bool) (string, bool) {
+	if hasAlias(typeDef) && !topLevel {
+		if isAliasBody(ctx, typeDef) {
+			ctx = withAliasBody(ctx, nil)
+		} else if useAlias(ctx, typeDef) {
+			namespace, aliasName := typeNames(typeDef)
+			return namespace + "." + aliasName, aliasNullable(typeDef)
+		}
+	}
+
 	switch typeDef.Kind() {
 	case reflect.Bool:
 		return "boolean", false
@@ -203,18 +319,38 @@ func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef refl
 	case reflect.Array:
 		var result strings.Builder
 
-		if typeDef.String() == "[]uint8" {
-			return "Uint8Array", true
+		nullable := typeDef.Kind() == reflect.Slice
+
+		if isBytes(typeDef) {
+			if isInput(ctx) {
+				return "ArrayBuffer | ArrayBufferView | Array<number> | string", nullable
+			}
+			return "Uint8Array", nullable
+		}
+
+		isLive := typeDef.Kind() == reflect.Slice && getMapSettings(ctx).structMode == StructModeLive && !isInput(ctx)
+		if typedName := typedArrayName(typeDef.Elem().Kind()); typedName != "" && !isLive {
+			return typedName, nullable
+		}
+
+		elemCtx := ctx
+		if typeDef.Kind() == reflect.Slice {
+			elemCtx = withAddressable(ctx, true)
 		}
 
 		result.WriteString("Array<")
-		jsName, undefined := d.typeToJSName(ctx, "", typeDef.Elem(), false, "", false)
+		jsName, elemNullable := d.typeToJSName(elemCtx, "", typeDef.Elem(), false, "", false)
 		result.WriteString(jsName)
-		if undefined {
-			result.WriteString(" | undefined")
+		if elemNullable {
+			result.WriteString(nilUnion(ctx))
 		}
 		result.WriteString(">")
-		return result.String(), true
+
+		if isLive {
+			return "Live<" + result.String() + ">", false
+		}
+
+		return result.String(), nullable
 	case reflect.Func:
 		var result strings.Builder
 
@@ -227,16 +363,23 @@ func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef refl
 
 		result.WriteString("(")
 
+		throws := false
 		if d.FuncMeta != nil {
 			if funcs, ok := d.FuncMeta[interfaceName]; ok {
 				if f, ok := funcs[name]; ok {
 					if f.Promise {
 						returnsPromise = f.Promise
 					}
+					throws = f.Throws
 				}
 			}
 		}
 
+		isPromise := returnsPromise
+		if d.Promises != nil {
+			isPromise = isPromise || d.Promises[name]
+		}
+
 		for i := 0; i < typeDef.NumIn(); i++ {
 			if i > 0 {
 				result.WriteString(", ")
@@ -244,31 +387,27 @@ func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef refl
 
 			in := typeDef.In(i)
 
-			if in.Kind() == reflect.Func {
-				returnsPromise = true
-			}
-
-			jsName, optional := d.typeToJSName(withContextStep(ctx, in.Name()), in.Name(), in, false, "", true)
+			// Callbacks are called synchronously, only promise functions can await the promises they return
+			inCtx := withAsyncCallback(withInput(withAddressable(withContextStep(ctx, in.Name()), false)), isPromise)
+			jsName, nullable := d.typeToJSName(inCtx, in.Name(), in, false, "", false)
 
 			argName := fmt.Sprintf("arg%d", i+1)
 
 			if d.FuncMeta != nil {
 				if funcs, ok := d.FuncMeta[interfaceName]; ok {
 					if f, ok := funcs[name]; ok {
-						if len(f.ArgNames)-1 >= i {
+						if len(f.ArgNames)-1 >= i && f.ArgNames[i] != "" {
 							argName = f.ArgNames[i]
 						}
 					}
 				}
 			}
 
-			if optional {
-				result.WriteString(fmt.Sprintf("%s?: ", argName))
-			} else {
-				result.WriteString(fmt.Sprintf("%s: ", argName))
-			}
-
+			result.WriteString(fmt.Sprintf("%s: ", argName))
 			result.WriteString(jsName)
+			if nullable {
+				result.WriteString(nilUnion(ctx))
+			}
 		}
 
 		result.WriteString(")")
@@ -279,45 +418,53 @@ func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef refl
 			result.WriteString(" => ")
 		}
 
-		isPromise := returnsPromise
-		if d.Promises != nil {
-			isPromise = isPromise || d.Promises[name]
+		outs := make([]reflect.Type, typeDef.NumOut())
+		for i := range outs {
+			outs[i] = typeDef.Out(i)
 		}
 
-		if isPromise {
-			result.WriteString("Promise<")
+		// Functions that throw do not return their trailing error, and callbacks report it by throwing
+		if (throws || isInput(ctx)) && len(outs) > 0 && outs[len(outs)-1] == errorType {
+			outs = outs[:len(outs)-1]
 		}
 
-		if typeDef.NumOut() > 0 {
-			if typeDef.NumOut() > 1 {
-				result.WriteString("[")
+		var returns strings.Builder
+		if len(outs) > 0 {
+			if len(outs) > 1 {
+				returns.WriteString("[")
 			}
 
-			for i := 0; i < typeDef.NumOut(); i++ {
+			for i, out := range outs {
 				if i > 0 {
-					result.WriteString(", ")
+					returns.WriteString(", ")
 				}
 
-				out := typeDef.Out(i)
-				jsName, optional := d.typeToJSName(withContextStep(ctx, out.Name()), out.Name(), out, false, "", false)
-				if optional {
-					result.WriteString("(")
-					result.WriteString(jsName)
-					result.WriteString(" | undefined)")
+				outCtx := withAsyncCallback(withAddressable(withContextStep(ctx, out.Name()), false), false)
+				jsName, nullable := d.typeToJSName(outCtx, out.Name(), out, false, "", false)
+				if nullable {
+					returns.WriteString("(")
+					returns.WriteString(jsName)
+					returns.WriteString(nilUnion(ctx))
+					returns.WriteString(")")
 				} else {
-					result.WriteString(jsName)
+					returns.WriteString(jsName)
 				}
 			}
 
-			if typeDef.NumOut() > 1 {
-				result.WriteString("]")
+			if len(outs) > 1 {
+				returns.WriteString("]")
 			}
 		} else {
-			result.WriteString("void")
+			returns.WriteString("void")
 		}
 
-		if isPromise {
-			result.WriteString(">")
+		switch {
+		case isPromise:
+			result.WriteString("Promise<" + returns.String() + ">")
+		case isAsyncCallback(ctx) && !(name != "" && topLevel):
+			result.WriteString(returns.String() + " | Promise<" + returns.String() + ">")
+		default:
+			result.WriteString(returns.String())
 		}
 
 		return result.String(), false
@@ -325,40 +472,187 @@ func (d *Definition) typeToJSName(ctx context.Context, name string, typeDef refl
 		var result strings.Builder
 		result.WriteString("Record<")
 
-		keyJsName, optional := d.typeToJSName(ctx, "", typeDef.Key(), false, "", false)
+		keyJsName, _ := d.typeToJSName(withAddressable(ctx, false), "", typeDef.Key(), false, "", false)
 		result.WriteString(keyJsName)
-		if optional {
-			result.WriteString(" | undefined")
-		}
 
 		result.WriteString(", ")
 
-		valueJsName, optional := d.typeToJSName(ctx, "", typeDef.Elem(), false, "", false)
+		valueJsName, nullable := d.typeToJSName(withAddressable(ctx, false), "", typeDef.Elem(), false, "", false)
 		result.WriteString(valueJsName)
-		if optional {
-			result.WriteString(" | undefined")
+		if nullable {
+			result.WriteString(nilUnion(ctx))
 		}
 
 		result.WriteString(">")
+
+		if getMapSettings(ctx).structMode == StructModeLive && !isInput(ctx) {
+			return "Live<" + result.String() + ">", false
+		}
+
 		return result.String(), true
 	case reflect.Pointer:
-		jsName, _ := d.typeToJSName(withContextStep(ctx, name), name, typeDef.Elem(), false, "", false)
+		if payload := emitterPayload(typeDef); payload != nil {
+			return d.emitterJSName(ctx, payload), false
+		}
+
+		jsName, _ := d.typeToJSName(withAddressable(withContextStep(ctx, name), true), name, typeDef.Elem(), false, "", false)
 		return jsName, true
 	case reflect.String:
 		return "string", false
 	case reflect.Struct:
-		noTypesName, _, _ := strings.Cut(typeDef.String(), "[")
+		if isHandle(typeDef) {
+			return handleJSName(typeDef), false
+		}
+
+		if directives, _ := typeDirectives(typeDef); directives.Ignore {
+			return "unknown", false
+		}
+
+		namespace, structName := typeNames(typeDef)
+		noTypesName := namespace + "." + structName
+		// Arguments are converted from plain objects, so they never have to be live
+		if !isInput(ctx) && getMapSettings(ctx).isLive(typeDef, isAddressable(ctx)) {
+			live := "Live<" + noTypesName + ">"
+			// Snapshots are copies, only live objects can be subscribed to
+			if isObservable(typeDef) && !getMapSettings(ctx).opts().Worker {
+				live += " & { subscribe(run: (value: " + live + ", field?: string) => void): () => void }"
+			}
+			return live, false
+		}
 		return noTypesName, false
 	case reflect.Interface:
 		if typeDef.String() == "error" {
-			return "Error", false
+			return "Error", true
 		}
-		return "unknown", true
+		if isImplemented(typeDef) {
+			namespace, interfaceName := typeNames(typeDef)
+			return namespace + "." + interfaceName, true
+		}
+		return "unknown", false
 	}
 
 	panic(fmt.Sprintf("un-convertable type: \"%s\" - %s (%s)", getContextSteps(ctx), typeDef.Kind().String(), typeDef.String()))
 }
 
+// emitterJSName returns the type of the object listeners subscribe to an emitter through
+func (d *Definition) emitterJSName(ctx context.Context, payload reflect.Type) string {
+	payloadCtx := withAsyncCallback(withAddressable(withContextStep(ctx, "payload"), false), false)
+	jsName, nullable := d.typeToJSName(payloadCtx, "", payload, false, "", false)
+	if nullable {
+		jsName += nilUnion(ctx)
+	}
+
+	listener := "(listener: (event: " + jsName + ") => void)"
+	return "{ on" + listener + ": () => void; once" + listener + ": () => void; off" + listener + ": void }"
+}
+
+// aliasNullable reports whether a referenced alias may be nil. It only depends on the kind,
+// as resolving the body of a recursive alias would never end.
+func aliasNullable(typeDef reflect.Type) bool {
+	switch typeDef.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer:
+		return true
+	}
+	return false
+}
+
+// useAlias reports whether a named type can be referenced by its alias. Composite types
+// render differently as inputs or under a struct mode, so those are written inline.
+func useAlias(ctx context.Context, typeDef reflect.Type) bool {
+	switch typeDef.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Pointer, reflect.Func:
+		return !isInput(ctx) && getMapSettings(ctx).structMode == StructModeAuto
+	}
+	return true
+}
+
+func (d *Definition) serializeAliases(ctx context.Context, path []string, hasMore bool) (string, string) {
+	options := getMapSettings(ctx).opts()
+	var tsdFile strings.Builder
+	var jsFile strings.Builder
+
+	indentation := strings.Repeat("  ", len(path))
+
+	names := SortedKeys(d.Aliases)
+	jsEnums := make([]string, 0)
+	for _, name := range names {
+		typeDef := d.Aliases[name]
+		values := d.Enums[name]
+
+		if directives, _ := typeDirectives(typeDef); directives.Deprecated {
+			tsdFile.WriteString(indentation + directives.deprecation() + "\n")
+		}
+
+		if len(values) == 0 {
+			jsType, _ := d.typeToJSName(withAliasBody(withContextStep(ctx, name), typeDef), name, typeDef, false, "", false)
+			tsdFile.WriteString(fmt.Sprintf("%stype %s = %s;\n", indentation, name, jsType))
+			continue
+		}
+
+		if d.isJSEnum(ctx, name) {
+			tsdFile.WriteString(fmt.Sprintf("%senum %s {\n", indentation, name))
+			for i, value := range values {
+				comma := ","
+				if i == len(values)-1 {
+					comma = ""
+				}
+				tsdFile.WriteString(fmt.Sprintf("%s  %s = %s%s\n", indentation, value.Name, enumLiteral(value.Value), comma))
+			}
+			tsdFile.WriteString(fmt.Sprintf("%s}\n", indentation))
+			jsEnums = append(jsEnums, name)
+			continue
+		}
+
+		literals := make([]string, 0, len(values))
+		seen := make(map[string]bool)
+		for _, value := range values {
+			literal := enumLiteral(value.Value)
+			if !seen[literal] {
+				seen[literal] = true
+				literals = append(literals, literal)
+			}
+		}
+		tsdFile.WriteString(fmt.Sprintf("%stype %s = %s;\n", indentation, name, strings.Join(literals, " | ")))
+	}
+
+	for i, name := range jsEnums {
+		comma := ","
+		if !options.TrailingComma && i == len(jsEnums)-1 && len(d.Entities) == 0 && !hasMore {
+			comma = ""
+		}
+
+		jsFile.WriteString(fmt.Sprintf("%s%s: %s%s\n", indentation, name, d.enumObject(name, options.QuoteStyle), comma))
+	}
+
+	return tsdFile.String(), jsFile.String()
+}
+
+// enumObject returns the JS object backing a TypeScript enum, with strings in the given quote
+func (d *Definition) enumObject(name string, quote string) string {
+	members := make([]string, 0)
+	for _, value := range d.Enums[name] {
+		literal := enumLiteral(value.Value)
+		if value.Value.Kind() == constant.String {
+			literal = quoteJS(constant.StringVal(value.Value), quote)
+		}
+		members = append(members, fmt.Sprintf("%s: %s", value.Name, literal))
+	}
+
+	// Numeric enums map their values back to the member names like TypeScript does
+	if d.Aliases[name].Kind() != reflect.String {
+		for _, value := range d.Enums[name] {
+			members = append(members, fmt.Sprintf("%s: %s", quoteJS(enumLiteral(value.Value), quote), quoteJS(value.Name, quote)))
+		}
+	}
+
+	return "{" + strings.Join(members, ", ") + "}"
+}
+
+// isJSEnum reports whether an alias is written as a TypeScript enum, which needs a JS object
+func (d *Definition) isJSEnum(ctx context.Context, name string) bool {
+	return len(d.Enums[name]) > 0 && getEnumStyle(ctx) == EnumStyleEnum && d.Aliases[name].Kind() != reflect.Bool
+}
+
 func (d *Definition) serializeDefinitions(ctx context.Context, definitions map[string]reflect.Type, path []string) (string, error) {
 	var tsdFile strings.Builder
 
@@ -379,42 +673,84 @@ func (d *Definition) serializeDefinitions(ctx context.Context, definitions map[s
 	return tsdFile.String(), nil
 }
 
-func (d *Definition) serializeEntities(ctx context.Context, entities map[string]reflect.Type, path []string, appName string) (string, string, error) {
+func (d *Definition) serializeEntities(ctx context.Context, entities map[string]reflect.Type, path []string, appName string, hasMore bool) (string, string, error) {
+	options := getMapSettings(ctx).opts()
 	var tsdFile strings.Builder
 	var jsFile strings.Builder
 
+	quote := func(value string) string {
+		return quoteJS(value, options.QuoteStyle)
+	}
+	global := "globalThis[" + quote("go") + "][" + quote(appName) + "]"
+
 	for i, name := range SortedKeys(entities) {
 		typeDef := entities[name]
-		jsType, optional := d.typeToJSName(withContextStep(ctx, name), name, typeDef, true, "", false)
+		getter := d.Getters[name]
+
+		var jsType string
+		var nullable bool
+		if getter {
+			// Getters read the variable itself, so its structs are live
+			jsType, nullable = d.typeToJSName(withAddressable(withContextStep(ctx, name), true), name, typeDef, false, "", false)
+		} else {
+			jsType, nullable = d.typeToJSName(withContextStep(ctx, name), name, typeDef, true, "", options.Worker)
+		}
+
+		if literal, ok := d.Consts[name]; ok {
+			jsType, nullable = literal, false
+		}
+
+		// Values are read from the worker, so they are only available asynchronously
+		if options.Worker && (getter || typeDef.Kind() != reflect.Func) {
+			if nullable {
+				jsType += nilUnion(ctx)
+			}
+			jsType, nullable = "Promise<"+jsType+">", false
+		}
+
+		if meta, ok := d.FuncMeta[""][name]; ok && meta.Deprecation != "" {
+			tsdFile.WriteString(strings.Repeat("  ", len(path)) + meta.Deprecation + "\n")
+		}
+
 		if len(path) == 0 {
-			jsFile.WriteString(strings.Replace(fmt.Sprintf(`%s = globalThis["go"]["%s"]["%s"];`, name, appName, name)+"\n", "\"", JSQuoteStyle, -1))
-			if optional {
-				tsdFile.WriteString(fmt.Sprintf("export const %s = %s | undefined;\n", name, jsType))
+			if typeDef.Kind() == reflect.Func {
+				jsFile.WriteString(fmt.Sprintf("%s = wrap(%s[%s]);\n", name, global, quote(name)))
+				tsdFile.WriteString(fmt.Sprintf("export %s;\n", jsType))
+				continue
+			}
+
+			jsFile.WriteString(fmt.Sprintf("%s = %s[%s];\n", name, global, quote(name)))
+			if nullable {
+				tsdFile.WriteString(fmt.Sprintf("export const %s: %s%s;\n", name, jsType, nilUnion(ctx)))
 			} else {
-				tsdFile.WriteString(fmt.Sprintf("export const %s = %s;\n", name, jsType))
+				tsdFile.WriteString(fmt.Sprintf("export const %s: %s;\n", name, jsType))
 			}
 		} else {
 			mergedPathJs := ""
 			for _, s := range path {
-				mergedPathJs += fmt.Sprintf(`["%s"]`, s)
+				mergedPathJs += "[" + quote(s) + "]"
 			}
 
 			indentation := strings.Repeat("  ", len(path))
 
 			comma := ","
-			if !JSTrailingComma && i == len(entities)-1 {
+			if !options.TrailingComma && i == len(entities)-1 && !hasMore {
 				comma = ""
 			}
 
-			if typeDef.Kind() != reflect.Func {
-				jsFile.WriteString(strings.Replace(fmt.Sprintf(`%s%s: globalThis["go"]["%s"]%s["%s"]%s`, indentation, name, appName, mergedPathJs, name, comma)+"\n", "\"", JSQuoteStyle, -1))
-				if optional {
-					tsdFile.WriteString(fmt.Sprintf("%sconst %s: %s | undefined;\n", indentation, name, jsType))
+			if getter || typeDef.Kind() != reflect.Func {
+				if getter {
+					jsFile.WriteString(fmt.Sprintf("%sget %s() { return %s%s[%s](); }%s\n", indentation, name, global, mergedPathJs, quote(name), comma))
+				} else {
+					jsFile.WriteString(fmt.Sprintf("%s%s: %s%s[%s]%s\n", indentation, name, global, mergedPathJs, quote(name), comma))
+				}
+				if nullable {
+					tsdFile.WriteString(fmt.Sprintf("%sconst %s: %s%s;\n", indentation, name, jsType, nilUnion(ctx)))
 				} else {
 					tsdFile.WriteString(fmt.Sprintf("%sconst %s: %s;\n", indentation, name, jsType))
 				}
 			} else {
-				jsFile.WriteString(strings.Replace(fmt.Sprintf(`%s%s: wrap(globalThis["go"]["%s"]%s["%s"])%s`, indentation, name, appName, mergedPathJs, name, comma)+"\n", "\"", JSQuoteStyle, -1))
+				jsFile.WriteString(fmt.Sprintf("%s%s: wrap(%s%s[%s])%s\n", indentation, name, global, mergedPathJs, quote(name), comma))
 				tsdFile.WriteString(fmt.Sprintf("%s%s;\n", indentation, jsType))
 			}
 		}
@@ -422,3 +758,71 @@ func (d *Definition) serializeEntities(ctx context.Context, entities map[string]
 
 	return tsdFile.String(), jsFile.String(), nil
 }
+
+// tsLiteral returns the TypeScript literal type of a basic value
+func tsLiteral(value reflect.Value) (string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return jsString(value.String()), true
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		if math.IsInf(value.Float(), 0) || math.IsNaN(value.Float()) {
+			return "number", true
+		}
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// jsString quotes a string so it is valid in both JS and TypeScript
+func jsString(value string) string {
+	var result strings.Builder
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	return strings.TrimSpace(result.String())
+}
+
+// quoteJS quotes a string for the generated JS with the configured quote style
+func quoteJS(value string, quote string) string {
+	quoted := jsString(value)
+	if quote == "\"" {
+		return quoted
+	}
+
+	var result strings.Builder
+	result.WriteString(quote)
+	inner := []rune(quoted[1 : len(quoted)-1])
+	for i := 0; i < len(inner); i++ {
+		switch {
+		case inner[i] == '\\' && inner[i+1] == '"':
+			result.WriteRune('"')
+			i++
+		case inner[i] == '\\':
+			result.WriteRune('\\')
+			result.WriteRune(inner[i+1])
+			i++
+		case string(inner[i]) == quote, quote == "`" && inner[i] == '$':
+			result.WriteRune('\\')
+			result.WriteRune(inner[i])
+		default:
+			result.WriteRune(inner[i])
+		}
+	}
+	result.WriteString(quote)
+
+	return result.String()
+}
+
+// nilUnion returns the union member that nil values are represented with
+func nilUnion(ctx context.Context) string {
+	if getMapSettings(ctx).nilMode == NilAsUndefined {
+		return " | undefined"
+	}
+	return " | null"
+}
@@ -0,0 +1,291 @@
+//go:build !js
+
+package crystalline
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+var outputShapes = map[string][]Option{
+	"default":   nil,
+	"undefined": {WithNilMode(NilAsUndefined)},
+	"live":      {WithStructMode(StructModeLive)},
+	"snapshot":  {WithStructMode(StructModeSnapshot)},
+	"enums":     {WithEnumStyle(EnumStyleEnum)},
+	"commonjs":  {WithTarget(TargetCommonJS)},
+	"umd":       {WithTarget(TargetUMD)},
+	"node":      {WithTarget(TargetNode)},
+}
+
+func buildOutputShape(t *testing.T, opts []Option) (string, string) {
+	e := NewExposer("app", opts...)
+
+	testza.AssertNoError(t, e.ExposeFunc(SomeFunc))
+	testza.AssertNoError(t, e.ExposeFunc(ErrorFunc))
+	testza.AssertNoError(t, e.ExposeFunc(InterfaceFunc))
+	testza.AssertNoError(t, e.ExposeFuncPromise(PromiseFunc, true))
+	testza.AssertNoError(t, e.ExposeFunc(FuncFunc))
+	testza.AssertNoError(t, e.ExposeFunc(ByteFunc))
+	testza.AssertNoError(t, e.ExposeFunc(ModeFunc))
+	testza.AssertNoError(t, e.ExposeFunc(NilFunc))
+	testza.AssertNoError(t, e.ExposeFunc(EnumFunc))
+	testza.AssertNoError(t, e.ExposeFunc(DirectiveFunc))
+
+	testza.AssertNoError(t, e.Expose(ExposeArrayTest, "crystalline", "ExposeArrayTest"))
+	testza.AssertNoError(t, e.Expose(ExposeSliceTest, "crystalline", "ExposeSliceTest"))
+	testza.AssertNoError(t, e.Expose(ExposeStringTest, "crystalline", "ExposeStringTest"))
+	testza.AssertNoError(t, e.Expose(ExposeStructTest, "crystalline", "ExposeStructTest"))
+	testza.AssertNoError(t, e.Expose(ExposePointerTest, "crystalline", "ExposePointerTest"))
+	testza.AssertNoError(t, e.Expose(ExposeMapTest, "crystalline", "ExposeMapTest"))
+	testza.AssertNoError(t, e.Expose(ExposeGenericStruct, "crystalline", "ExposeGenericStruct"))
+	testza.AssertNoError(t, e.Expose(ExposeInheritedStructTest, "crystalline", "ExposeInheritedStructTest"))
+	testza.AssertNoError(t, e.ExposeConst(MaxSize, "crystalline", "MaxSize"))
+	testza.AssertNoError(t, e.ExposeVar(&Counter, "crystalline", "Counter"))
+	testza.AssertNoError(t, e.ExposeVar(&Current, "crystalline", "Current"))
+	testza.AssertNoError(t, e.ExposeVar(&CurrentStatus, "crystalline", "CurrentStatus"))
+	testza.AssertNoError(t, e.Expose(&Emitter[FileChange]{}, "crystalline", "Changes"))
+
+	testza.AssertNoError(t, e.Expose(ExposeStringTest, "api", "Version"))
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "api.v2.users", "Count"))
+	testza.AssertNoError(t, e.ExposeFuncIn(SomeFunc, "api.v2", false))
+	testza.AssertNoError(t, e.ExposeVar(&Counter, "api.v2", "Counter"))
+
+	testza.AssertNoError(t, e.Expose(ExposeIntTest, "", "RootInt"))
+	testza.AssertNoError(t, e.ExposeConst(StatusActive, "", "RootStatus"))
+	testza.AssertNoError(t, e.AddEntity(nil, "RootFunc", reflect.TypeOf(SomeFunc), false))
+	testza.AssertNoError(t, e.AddEntity(nil, "GlobalTest", reflect.TypeOf(GlobalTestObj{}), false))
+
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(ModeObj{})))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(NilObj{})))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(EnumObj{})))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(DirectiveObj{})))
+	testza.AssertNoError(t, e.AddDefinition(reflect.TypeOf(TreeNode{})))
+
+	tsdFile, jsFile, err := e.Build()
+	testza.AssertNoError(t, err)
+
+	return tsdFile, jsFile
+}
+
+// findTypeScriptCompiler looks for a tsc installed in a node_modules of the package or its parents
+func findTypeScriptCompiler() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		candidate := filepath.Join(dir, "node_modules", ".bin", "tsc")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func TestTypeScriptCompiles(t *testing.T) {
+	tsc := findTypeScriptCompiler()
+	if tsc == "" {
+		// CI installs TypeScript, so a missing compiler there must not pass silently
+		if os.Getenv("CI") != "" {
+			t.Fatal("tsc not found, the workflow must run npm install before the tests")
+		}
+		t.Skip("tsc not found, run npm install to validate the typings")
+	}
+
+	for name, opts := range outputShapes {
+		t.Run(name, func(t *testing.T) {
+			tsdFile, _ := buildOutputShape(t, opts)
+
+			dir := t.TempDir()
+			testza.AssertNoError(t, os.WriteFile(filepath.Join(dir, "app.d.ts"), []byte(tsdFile), 0o644))
+			testza.AssertNoError(t, os.WriteFile(filepath.Join(dir, "usage.ts"), []byte(`import * as app from "./app";
+
+app.init("app.wasm").then(() => console.log("ready"));
+
+const size: 1024 = app.crystalline.MaxSize;
+const rootStatus: "active" = app.RootStatus;
+const status: app.crystalline.Status = app.crystalline.CurrentStatus;
+const greeting: [string, boolean] = app.RootFunc("name", true);
+const counter: number = app.crystalline.Counter + app.RootInt + app.api.v2.users.Count + app.api.v2.Counter;
+const nested: [string, boolean] = app.api.v2.SomeFunc(app.api.Version, false);
+const level: app.crystalline.Level = app.crystalline.EnumFunc(status, null);
+
+const unsubscribe: () => void = app.crystalline.Changes.on((event) => console.log(event.Path, event.Removed));
+
+console.log(size, rootStatus, greeting, counter, nested, level, unsubscribe);
+`), 0o644))
+
+			output, err := exec.Command(tsc, "--noEmit", "--strict", "--target", "es2020", "--module", "es2020", "--moduleResolution", "node", filepath.Join(dir, "usage.ts")).CombinedOutput()
+			testza.AssertNoError(t, err, string(output))
+		})
+	}
+}
+
+func TestJavaScriptSyntax(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	for name, opts := range outputShapes {
+		t.Run(name, func(t *testing.T) {
+			options := &Options{}
+			for _, opt := range opts {
+				opt(options)
+			}
+			_, jsFile := buildOutputShape(t, opts)
+
+			file := filepath.Join(t.TempDir(), "app.mjs")
+			if options.Target != TargetESM {
+				file = filepath.Join(t.TempDir(), "app.cjs")
+			}
+			testza.AssertNoError(t, os.WriteFile(file, []byte(jsFile), 0o644))
+
+			output, err := exec.Command(node, "--check", file).CombinedOutput()
+			testza.AssertNoError(t, err, string(output))
+		})
+	}
+}
+
+// buildTestApp compiles a program of testdata to wasm and runs it natively to write its glue into a temporary directory
+func buildTestApp(t *testing.T, name string) string {
+	goBin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	dir := t.TempDir()
+
+	build := exec.Command(goBin, "build", "-o", filepath.Join(dir, "app.wasm"), "./testdata/"+name)
+	build.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	output, err := build.CombinedOutput()
+	testza.AssertNoError(t, err, string(output))
+
+	output, err = exec.Command(goBin, "run", "./testdata/"+name, dir).CombinedOutput()
+	testza.AssertNoError(t, err, string(output))
+
+	wasmExec, err := os.ReadFile(filepath.Join(runtime.GOROOT(), "lib", "wasm", "wasm_exec.js"))
+	if err != nil {
+		wasmExec, err = os.ReadFile(filepath.Join(runtime.GOROOT(), "misc", "wasm", "wasm_exec.js"))
+	}
+	testza.AssertNoError(t, err)
+	testza.AssertNoError(t, os.WriteFile(filepath.Join(dir, "wasm_exec.js"), wasmExec, 0o644))
+
+	return dir
+}
+
+func TestNodeTarget(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	dir := buildTestApp(t, "node")
+
+	testza.AssertNoError(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte(`const app = require("./app.js");
+app.ready.then(() => {
+  console.log(app.main.Add(1, 2));
+  process.exit(0);
+});
+`), 0o644))
+
+	output, err := exec.Command(node, filepath.Join(dir, "main.js")).CombinedOutput()
+	testza.AssertNoError(t, err, string(output))
+	testza.AssertEqual(t, "3\n", string(output))
+}
+
+func TestWorkerMode(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	dir := buildTestApp(t, "worker")
+
+	// Node has no Web Workers, so the worker script runs in the same thread behind structured clones
+	testza.AssertNoError(t, os.WriteFile(filepath.Join(dir, "main.mjs"), []byte(`import fs from "fs";
+import path from "path";
+import util from "util";
+import { createRequire } from "module";
+
+const require = createRequire(import.meta.url);
+globalThis.fs = fs;
+globalThis.path = path;
+globalThis.TextEncoder = util.TextEncoder;
+globalThis.TextDecoder = util.TextDecoder;
+
+class FakeWorker {
+  constructor(url) {
+    const self = {
+      postMessage: (data, transfer) => setTimeout(() => this.onmessage({ data: structuredClone(data, { transfer }) })),
+    };
+    const importScripts = (script) => require(path.resolve(script));
+    const fetch = async (file) => ({ arrayBuffer: async () => fs.readFileSync(file) });
+    new Function("self", "importScripts", "fetch", fs.readFileSync(url, "utf8"))(self, importScripts, fetch);
+    this.self = self;
+  }
+
+  postMessage(data, transfer) {
+    const cloned = structuredClone(data, { transfer });
+    setTimeout(() => this.self.onmessage({ data: cloned }));
+  }
+}
+
+globalThis.Worker = FakeWorker;
+process.chdir(path.dirname(new URL(import.meta.url).pathname));
+
+const app = await import("./app.mjs");
+const worker = new FakeWorker("worker.js");
+await app.init(worker);
+
+console.log(await app.main.Add(1, 2));
+
+const bytes = await app.main.Bytes(4);
+console.log(bytes.constructor.name, bytes.length);
+
+const input = new Uint8Array([1, 2, 3]);
+console.log(await app.main.Total(input), input.byteLength);
+
+console.log(JSON.stringify(await app.main.Move({ X: 1, Y: 2 }, 3)));
+
+console.log((await app.main.Fail()).message);
+
+try {
+  await app.main.Add(() => {}, 1);
+} catch (error) {
+  console.log(error.name);
+}
+
+const crashed = app.main.Add(4, 5);
+setTimeout(() => worker.onerror({ message: "worker crashed" }));
+try {
+  await crashed;
+} catch (error) {
+  console.log(error.message);
+}
+console.log(await Promise.race([app.main.Add(4, 5), new Promise((resolve) => setTimeout(() => resolve("timeout"), 1000))]));
+
+process.exit(0);
+`), 0o644))
+
+	output, err := exec.Command(node, filepath.Join(dir, "main.mjs")).CombinedOutput()
+	testza.AssertNoError(t, err, string(output))
+	testza.AssertEqual(t, `3
+Uint8Array 4
+6 0
+{"X":4,"Y":2}
+failed
+DataCloneError
+worker crashed
+9
+`, string(output))
+}
@@ -0,0 +1,8 @@
+//go:build !js
+
+package crystalline
+
+// jsUndefined is just a placeholder
+func jsUndefined() interface{} {
+	return nil
+}
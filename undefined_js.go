@@ -0,0 +1,9 @@
+//go:build js
+
+package crystalline
+
+import "syscall/js"
+
+func jsUndefined() interface{} {
+	return js.Undefined()
+}
@@ -6,6 +6,7 @@ import (
 	"go/token"
 	"os"
 	"path"
+	"reflect"
 	"runtime"
 	"sort"
 	"strings"
@@ -22,6 +23,102 @@ func SortedKeys[T any](data map[string]T) []string {
 	return result
 }
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// handle is implemented by the types holding a JS value that crosses the boundary untouched
+type handle interface {
+	handleType() reflect.Type
+}
+
+// handleMarker is the first field of every Handle[T], so they are told apart from structs embedding one
+type handleMarker struct{}
+
+var (
+	handleMarkerType = reflect.TypeOf(handleMarker{})
+	jsValueWrapper   = reflect.TypeOf(JSValue{})
+)
+
+// isHandle reports whether a type is exactly JSValue, a Handle[T] or js.Value itself
+func isHandle(typeDef reflect.Type) bool {
+	if typeDef == jsValueWrapper || typeDef.PkgPath() == "syscall/js" && typeDef.Name() == "Value" {
+		return true
+	}
+	return typeDef.Kind() == reflect.Struct && typeDef.NumField() > 0 && typeDef.Field(0).Type == handleMarkerType
+}
+
+// handleJSName returns the TS type of a handle, named like its type parameter
+func handleJSName(typeDef reflect.Type) string {
+	if typeDef.Kind() != reflect.Struct || typeDef.NumField() == 0 || typeDef.Field(0).Type != handleMarkerType {
+		return "unknown"
+	}
+
+	target := reflect.Zero(typeDef).Interface().(handle).handleType()
+	if target == nil || target.Name() == "" {
+		return "unknown"
+	}
+
+	name, _, _ := strings.Cut(target.Name(), "[")
+	return name
+}
+
+// emitter is implemented by pointers to an Emitter
+type emitter interface {
+	payloadType() reflect.Type
+}
+
+// emitterMarker is the first field of every Emitter[T], so they are told apart from structs embedding one
+type emitterMarker struct{}
+
+var emitterMarkerType = reflect.TypeOf(emitterMarker{})
+
+// emitterPayload returns the payload type of an emitter pointer, or nil for any other type
+func emitterPayload(typeDef reflect.Type) reflect.Type {
+	if typeDef.Kind() != reflect.Pointer {
+		return nil
+	}
+
+	elem := typeDef.Elem()
+	if elem.Kind() != reflect.Struct || elem.NumField() == 0 || elem.Field(0).Type != emitterMarkerType {
+		return nil
+	}
+	return reflect.Zero(typeDef).Interface().(emitter).payloadType()
+}
+
+func isBytes(typeDef reflect.Type) bool {
+	return (typeDef.Kind() == reflect.Slice || typeDef.Kind() == reflect.Array) && typeDef.Elem().Kind() == reflect.Uint8
+}
+
+func typedArrayName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int8:
+		return "Int8Array"
+	case reflect.Int16:
+		return "Int16Array"
+	case reflect.Int32:
+		return "Int32Array"
+	case reflect.Uint8:
+		return "Uint8Array"
+	case reflect.Uint16:
+		return "Uint16Array"
+	case reflect.Uint32:
+		return "Uint32Array"
+	case reflect.Float32:
+		return "Float32Array"
+	case reflect.Float64:
+		return "Float64Array"
+	}
+	return ""
+}
+
+func hasTagOption(field reflect.StructField, option string) bool {
+	for _, value := range strings.Split(field.Tag.Get("crystalline"), ",") {
+		if strings.TrimSpace(value) == option {
+			return true
+		}
+	}
+	return false
+}
+
 func findFunction(pointer uintptr) *ast.FuncDecl {
 	pc := runtime.FuncForPC(pointer)
 
@@ -50,3 +147,13 @@ func findFunction(pointer uintptr) *ast.FuncDecl {
 	}
 	return nil
 }
+
+// jsReserved are the words that cannot be used as identifiers in TypeScript declarations
+var jsReserved = map[string]bool{
+	"arguments": true, "await": true, "class": true, "catch": true, "debugger": true, "delete": true,
+	"do": true, "enum": true, "eval": true, "export": true, "extends": true, "false": true,
+	"finally": true, "function": true, "implements": true, "in": true, "instanceof": true,
+	"let": true, "new": true, "null": true, "private": true, "protected": true, "public": true,
+	"static": true, "super": true, "this": true, "throw": true, "true": true, "try": true,
+	"typeof": true, "void": true, "while": true, "with": true, "yield": true,
+}
@@ -0,0 +1,237 @@
+package crystalline
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ValidationError is a JS value rejected while converting it to Go, with the path to it, e.g. args[0].Tags[1]
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	path := strings.TrimPrefix(e.Path, ".")
+	if path == "" {
+		return e.Message
+	}
+	return path + ": " + e.Message
+}
+
+// at prefixes the path with the segment the value was found at
+func (e *ValidationError) at(segment string) *ValidationError {
+	e.Path = segment + e.Path
+	return e
+}
+
+// validationRules are the constraints of a validate tag, e.g. `validate:"min=1,max=64,regex=^[a-z]+$"`.
+// min and max bound numbers and the length of strings, slices and maps, len sets the exact length.
+// regex must come last, as the pattern may contain commas.
+type validationRules struct {
+	min     *float64
+	max     *float64
+	length  *int
+	pattern *regexp.Regexp
+}
+
+// parseValidationRules returns the rules of a field, or nil if it has no validate tag
+func parseValidationRules(field reflect.StructField) (*validationRules, error) {
+	tag, ok := field.Tag.Lookup("validate")
+	if !ok {
+		return nil, nil
+	}
+
+	typeDef := field.Type
+	for typeDef.Kind() == reflect.Pointer {
+		typeDef = typeDef.Elem()
+	}
+
+	rules := &validationRules{}
+	for tag != "" {
+		var option string
+		if strings.HasPrefix(tag, "regex=") {
+			option, tag = tag, ""
+		} else {
+			option, tag, _ = strings.Cut(tag, ",")
+		}
+
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch key {
+		case "min", "max":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil || !isNumber(typeDef) && !hasLength(typeDef) {
+				return nil, fmt.Errorf("invalid validate option %q on %s", option, field.Name)
+			}
+
+			if key == "min" {
+				rules.min = &number
+			} else {
+				rules.max = &number
+			}
+		case "len":
+			length, err := strconv.Atoi(value)
+			if err != nil || length < 0 || !hasLength(typeDef) {
+				return nil, fmt.Errorf("invalid validate option %q on %s", option, field.Name)
+			}
+			rules.length = &length
+		case "regex":
+			pattern, err := regexp.Compile(value)
+			if err != nil || typeDef.Kind() != reflect.String {
+				return nil, fmt.Errorf("invalid validate option %q on %s", option, field.Name)
+			}
+			rules.pattern = pattern
+		default:
+			return nil, fmt.Errorf("unknown validate option %q on %s", option, field.Name)
+		}
+	}
+
+	return rules, nil
+}
+
+// check returns why a converted value breaks the rules, nil pointers are left to not_nil
+func (r *validationRules) check(value reflect.Value) error {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if isNumber(value.Type()) {
+		var number float64
+		switch {
+		case value.CanInt():
+			number = float64(value.Int())
+		case value.CanUint():
+			number = float64(value.Uint())
+		default:
+			number = value.Float()
+		}
+
+		if r.min != nil && number < *r.min {
+			return fmt.Errorf("must be at least %v, got %v", *r.min, number)
+		}
+		if r.max != nil && number > *r.max {
+			return fmt.Errorf("must be at most %v, got %v", *r.max, number)
+		}
+		return nil
+	}
+
+	// Strings are measured like in JS, in UTF-16 code units
+	length := value.Len()
+	if value.Kind() == reflect.String {
+		length = len(utf16.Encode([]rune(value.String())))
+	}
+
+	if r.length != nil && length != *r.length {
+		return fmt.Errorf("length must be %d, got %d", *r.length, length)
+	}
+	if r.min != nil && float64(length) < *r.min {
+		return fmt.Errorf("length must be at least %v, got %d", *r.min, length)
+	}
+	if r.max != nil && float64(length) > *r.max {
+		return fmt.Errorf("length must be at most %v, got %d", *r.max, length)
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value.String()) {
+		return fmt.Errorf("must match %s", r.pattern.String())
+	}
+
+	return nil
+}
+
+func isNumber(typeDef reflect.Type) bool {
+	switch typeDef.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasLength(typeDef reflect.Type) bool {
+	switch typeDef.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// hasValidation reports whether converting a type may check validate tags, so errors need a path
+func hasValidation(typeDef reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[typeDef] {
+		return false
+	}
+	seen[typeDef] = true
+
+	if isEnum(typeDef) {
+		return true
+	}
+
+	switch typeDef.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasValidation(typeDef.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < typeDef.NumField(); i++ {
+			field := typeDef.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, ok := field.Tag.Lookup("validate"); ok || hasValidation(field.Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkValidationTags parses every validate tag reachable from a type, so mistakes fail when exposing
+// instead of at the first call
+func checkValidationTags(typeDef reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[typeDef] {
+		return nil
+	}
+	seen[typeDef] = true
+
+	switch typeDef.Kind() {
+	case reflect.Map:
+		if err := checkValidationTags(typeDef.Key(), seen); err != nil {
+			return err
+		}
+		fallthrough
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return checkValidationTags(typeDef.Elem(), seen)
+	case reflect.Func:
+		for i := 0; i < typeDef.NumIn(); i++ {
+			if err := checkValidationTags(typeDef.In(i), seen); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < typeDef.NumOut(); i++ {
+			if err := checkValidationTags(typeDef.Out(i), seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < typeDef.NumField(); i++ {
+			field := typeDef.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, err := parseValidationRules(field); err != nil {
+				return fmt.Errorf("invalid field %s.%s: %w", typeDef.Name(), field.Name, err)
+			}
+			if err := checkValidationTags(field.Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
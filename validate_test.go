@@ -0,0 +1,71 @@
+package crystalline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+type ValidatedObj struct {
+	Count  int               `validate:"min=1,max=10"`
+	Code   *string           `validate:"len=3"`
+	Labels map[string]string `validate:"max=1"`
+	Slug   string            `validate:"min=1,regex=^[a-z]+(,[a-z]+)*$"`
+}
+
+func TestValidationRules(t *testing.T) {
+	typeDef := reflect.TypeOf(ValidatedObj{})
+	check := func(field string, value any) error {
+		structField, _ := typeDef.FieldByName(field)
+		rules, err := parseValidationRules(structField)
+		testza.AssertNoError(t, err)
+		return rules.check(reflect.ValueOf(value))
+	}
+
+	testza.AssertNoError(t, check("Count", 5))
+	testza.AssertEqual(t, "must be at least 1, got 0", check("Count", 0).Error())
+	testza.AssertEqual(t, "must be at most 10, got 11", check("Count", 11).Error())
+
+	code := "abcd"
+	testza.AssertNoError(t, check("Code", (*string)(nil)))
+	testza.AssertEqual(t, "length must be 3, got 4", check("Code", &code).Error())
+
+	testza.AssertEqual(t, "length must be at most 1, got 2", check("Labels", map[string]string{"a": "", "b": ""}).Error())
+
+	testza.AssertNoError(t, check("Slug", "a,b"))
+	testza.AssertEqual(t, "must match ^[a-z]+(,[a-z]+)*$", check("Slug", "A").Error())
+
+	// Lengths are counted in UTF-16 code units, like in JS
+	emoji := "😀"
+	testza.AssertEqual(t, "length must be 3, got 2", check("Code", &emoji).Error())
+
+	_, err := parseValidationRules(reflect.StructField{Name: "Flag", Type: reflect.TypeOf(true), Tag: `validate:"min=1"`})
+	testza.AssertEqual(t, `invalid validate option "min=1" on Flag`, err.Error())
+
+	_, err = parseValidationRules(reflect.StructField{Name: "Count", Type: reflect.TypeOf(0), Tag: `validate:"regex=^a$"`})
+	testza.AssertEqual(t, `invalid validate option "regex=^a$" on Count`, err.Error())
+
+	_, err = parseValidationRules(reflect.StructField{Name: "Name", Type: reflect.TypeOf(""), Tag: `validate:"email"`})
+	testza.AssertEqual(t, `unknown validate option "email" on Name`, err.Error())
+
+	testza.AssertEqual(t, "args[0].Tags[1]: expected string, got number", (&ValidationError{Path: ".Tags[1]", Message: "expected string, got number"}).at("args[0]").Error())
+	testza.AssertEqual(t, "is required", (&ValidationError{Message: "is required"}).Error())
+
+	testza.AssertTrue(t, hasValidation(reflect.TypeOf([]*ValidatedObj{}), make(map[reflect.Type]bool)))
+	testza.AssertFalse(t, hasValidation(reflect.TypeOf(TreeNode{}), make(map[reflect.Type]bool)))
+}
+
+type BrokenValidatedItem struct {
+	Name string `validate:"min=a"`
+}
+
+type BrokenValidatedObj struct {
+	Items []BrokenValidatedItem
+}
+
+func TestExposerBrokenValidation(t *testing.T) {
+	e := NewExposer("app")
+	err := e.AddDefinition(reflect.TypeOf(BrokenValidatedObj{}))
+	testza.AssertEqual(t, `invalid field BrokenValidatedItem.Name: invalid validate option "min=a" on Name`, err.Error())
+}
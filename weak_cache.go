@@ -2,26 +2,60 @@ package crystalline
 
 import (
 	"runtime"
+	"sync"
 )
 
 type fetch[T any] func() (T, error)
 
 type WeakCache[T any] struct {
 	reachable map[uintptr]T //nolint:structcheck
+	fetching  map[uintptr]*pendingFetch[T]
+	mutex     sync.Mutex
+}
+
+// pendingFetch is a value being fetched, which concurrent fetches of the same key wait for
+type pendingFetch[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
 }
 
 func NewWeak[T any]() *WeakCache[T] {
 	return &WeakCache[T]{
 		reachable: make(map[uintptr]T),
+		fetching:  make(map[uintptr]*pendingFetch[T]),
 	}
 }
 
+// Fetch returns the cached value of a key, or fetches it once. Fetches of the same key wait for the first one,
+// so a value holding resources is never built twice. fetch may fetch other keys, but never its own.
 func (c *WeakCache[T]) Fetch(key uintptr, fetch fetch[T]) (T, error) {
+	c.mutex.Lock()
 	if found, ok := c.reachable[key]; ok {
+		c.mutex.Unlock()
 		return found, nil
 	}
 
+	if pending, ok := c.fetching[key]; ok {
+		c.mutex.Unlock()
+		<-pending.done
+		return pending.value, pending.err
+	}
+
+	pending := &pendingFetch[T]{done: make(chan struct{})}
+	c.fetching[key] = pending
+	c.mutex.Unlock()
+
+	// The lock is not held while fetching, as fetching may recurse into the same cache
 	value, err := fetch()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.fetching, key)
+	pending.value, pending.err = value, err
+	close(pending.done)
+
 	if err != nil {
 		return value, err
 	}
@@ -35,7 +69,11 @@ func (c *WeakCache[T]) Fetch(key uintptr, fetch fetch[T]) (T, error) {
 	return value, nil
 }
 
+// unref is called by finalizers, which run on their own goroutine
 func (c *WeakCache[T]) unref(index uintptr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	if _, ok := c.reachable[index]; !ok {
 		return
 	}
@@ -44,5 +82,8 @@ func (c *WeakCache[T]) unref(index uintptr) {
 }
 
 func (c *WeakCache[T]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	return len(c.reachable)
 }
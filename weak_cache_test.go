@@ -0,0 +1,73 @@
+package crystalline
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MarvinJWendt/testza"
+)
+
+func TestWeakCacheConcurrent(t *testing.T) {
+	cache := NewWeak[int]()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for key := uintptr(0); key < 32; key++ {
+				value, err := cache.Fetch(key, func() (int, error) {
+					return int(key), nil
+				})
+				testza.AssertNoError(t, err)
+				testza.AssertEqual(t, int(key), value)
+
+				if i%2 == 0 {
+					cache.unref(key)
+				}
+			}
+			cache.Len()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWeakCacheRecursiveFetch(t *testing.T) {
+	cache := NewWeak[int]()
+
+	value, err := cache.Fetch(1, func() (int, error) {
+		inner, err := cache.Fetch(2, func() (int, error) {
+			return 2, nil
+		})
+		return inner + 1, err
+	})
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, 3, value)
+	testza.AssertEqual(t, 2, cache.Len())
+}
+
+func TestWeakCacheSingleFetch(t *testing.T) {
+	cache := NewWeak[int]()
+
+	var fetches atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.Fetch(1, func() (int, error) {
+				fetches.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return 1, nil
+			})
+			testza.AssertNoError(t, err)
+			testza.AssertEqual(t, 1, value)
+		}()
+	}
+	wg.Wait()
+
+	// Concurrent fetches wait for the first one instead of building a value that is thrown away
+	testza.AssertEqual(t, int32(1), fetches.Load())
+}
@@ -0,0 +1,249 @@
+package crystalline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// proxyMember is a member of a namespace in the main thread proxy
+type proxyMember struct {
+	name   string
+	value  string
+	getter bool
+}
+
+// transferableHelper prepares the values posted between the main thread and the worker
+const transferableHelper = `// Typed arrays owning their whole buffer are transferred, others are copied as they may view memory in use,
+// like the wasm memory. Functions cannot be cloned, so methods of results are dropped, while arguments keep them
+// for postMessage to reject.
+const transferable = (value, transfers, dropFunctions = true) => {
+  if (ArrayBuffer.isView(value) && !(value instanceof DataView)) {
+    const owned = value.byteOffset === 0 && value.byteLength === value.buffer.byteLength ? value : value.slice();
+    if (!transfers.includes(owned.buffer)) {
+      transfers.push(owned.buffer);
+    }
+    return owned;
+  }
+
+  if (Array.isArray(value)) {
+    return value.map((item) => transferable(item, transfers, dropFunctions));
+  }
+
+  if (typeof value === "function" && dropFunctions) {
+    return undefined;
+  }
+
+  if (value !== null && typeof value === "object" && !(value instanceof Error)) {
+    const out = {};
+    for (const key of Object.keys(value)) {
+      const item = transferable(value[key], transfers, dropFunctions);
+      if (item !== undefined) {
+        out[key] = item;
+      }
+    }
+    return out;
+  }
+
+  return value;
+};
+`
+
+const proxyHeader = transferableHelper + `
+let resolveWorker;
+const worker = new Promise((resolve) => {
+  resolveWorker = resolve;
+});
+
+let nextId = 0;
+const pending = new Map();
+
+const call = async (path, args) => {
+  const target = await worker;
+  return new Promise((resolve, reject) => {
+    const id = nextId++;
+    pending.set(id, { resolve, reject });
+    try {
+      const transfers = [];
+      target.postMessage({ id, path, args: transferable(args, transfers, false) }, transfers);
+    } catch (error) {
+      pending.delete(id);
+      reject(error);
+    }
+  });
+};
+
+export const init = (source) => {
+  const target = source instanceof Worker ? source : new Worker(source);
+  target.onmessage = (event) => {
+    const { id, result, error } = event.data;
+    const handlers = pending.get(id);
+    if (handlers === undefined) {
+      return;
+    }
+    pending.delete(id);
+    if (error !== undefined) {
+      handlers.reject(new Error(error));
+    } else {
+      handlers.resolve(result);
+    }
+  };
+  // A failed worker answers none of the calls in flight, so they are all rejected
+  const fail = (error) => {
+    for (const { reject } of pending.values()) {
+      reject(error);
+    }
+    pending.clear();
+  };
+  target.onerror = (event) => fail(new Error(event.message || "the worker failed"));
+  target.onmessageerror = () => fail(new Error("a message from the worker could not be deserialized"));
+  resolveWorker(target);
+  return call([]);
+};
+`
+
+const workerBody = transferableHelper + `self.onmessage = async (event) => {
+  const { id, path, args } = event.data;
+  try {
+    await ready;
+
+    if (path.length === 0) {
+      self.postMessage({ id });
+      return;
+    }
+
+    let target = globalThis.go[appName];
+    for (const key of path) {
+      target = target[key];
+    }
+
+    let result = target;
+    if (args !== undefined) {
+      result = target(...args);
+      if (globalThis.goInternalError) {
+        const error = globalThis.goInternalError;
+        globalThis.goInternalError = undefined;
+        throw error instanceof Error ? error : new Error(error);
+      }
+    }
+
+    const transfers = [];
+    const cloned = transferable(await result, transfers);
+    self.postMessage({ id, result: cloned }, transfers);
+  } catch (error) {
+    self.postMessage({ id, error: error instanceof Error ? error.message : String(error) });
+  }
+};`
+
+// serializeProxy returns the main thread proxy module forwarding every exposed entity to the worker
+func (d *Definition) serializeProxy(ctx context.Context) string {
+	options := getMapSettings(ctx).opts()
+
+	var jsFile strings.Builder
+
+	for _, member := range d.proxyMembers(ctx, nil) {
+		jsFile.WriteString(fmt.Sprintf("\nexport const %s = %s;", member.name, member.value))
+	}
+
+	return strings.Replace(proxyHeader, "\"", options.QuoteStyle, -1) + jsFile.String()
+}
+
+func (d *Definition) proxyMembers(ctx context.Context, path []string) []proxyMember {
+	options := getMapSettings(ctx).opts()
+	members := make([]proxyMember, 0)
+
+	for _, name := range SortedKeys(d.Aliases) {
+		if d.isJSEnum(ctx, name) {
+			members = append(members, proxyMember{name: name, value: d.enumObject(name, options.QuoteStyle)})
+		}
+	}
+
+	for _, name := range SortedKeys(d.Entities) {
+		target := proxyPath(append(append([]string{}, path...), name), options.QuoteStyle)
+
+		switch {
+		case d.Getters[name]:
+			members = append(members, proxyMember{name: name, value: fmt.Sprintf("call(%s, [])", target), getter: true})
+		case d.Entities[name].Kind() == reflect.Func:
+			members = append(members, proxyMember{name: name, value: fmt.Sprintf("(...args) => call(%s, args)", target)})
+		default:
+			members = append(members, proxyMember{name: name, value: fmt.Sprintf("call(%s)", target)})
+		}
+	}
+
+	for _, name := range SortedKeys(d.Nested) {
+		nested := d.Nested[name].proxyMembers(ctx, append(append([]string{}, path...), name))
+		if len(nested) > 0 {
+			members = append(members, proxyMember{name: name, value: proxyObject(ctx, nested)})
+		}
+	}
+
+	return members
+}
+
+func proxyObject(ctx context.Context, members []proxyMember) string {
+	lines := make([]string, len(members))
+	for i, member := range members {
+		if member.getter {
+			lines[i] = fmt.Sprintf("get %s() { return %s; }", member.name, member.value)
+		} else {
+			lines[i] = fmt.Sprintf("%s: %s", member.name, member.value)
+		}
+	}
+
+	body := strings.Join(lines, ",\n")
+	if getMapSettings(ctx).opts().TrailingComma {
+		body += ","
+	}
+
+	return "{\n" + indent(body) + "\n}"
+}
+
+func proxyPath(path []string, quote string) string {
+	quoted := make([]string, len(path))
+	for i, segment := range path {
+		quoted[i] = quoteJS(segment, quote)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func indent(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BuildWorker returns the script the Web Worker created by the proxy of an exposer WithWorker runs.
+// It loads wasm_exec.js and the wasm binary, and answers calls once Go called crystalline.Ready().
+func (e *Exposer) BuildWorker() (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.options.Worker {
+		return "", errors.New("the worker script is only available for exposers created WithWorker")
+	}
+
+	script := fmt.Sprintf(strings.Replace(`importScripts(%s);
+
+const appName = %s;
+
+const ready = (async () => {
+  const go = new Go();
+  const response = await fetch(%s);
+  const result = await WebAssembly.instantiate(await response.arrayBuffer(), go.importObject);
+  await new Promise((resolve, reject) => {
+    (globalThis.goReady ??= {})[appName] = resolve;
+    go.run(result.instance).then(() => reject(new Error("the Go program exited before calling crystalline.Ready()")));
+  });
+})();
+
+`, "\"", e.options.QuoteStyle, -1), quoteJS(e.options.WasmExecPath, e.options.QuoteStyle), quoteJS(e.appName, e.options.QuoteStyle), quoteJS(e.options.WasmPath, e.options.QuoteStyle))
+
+	return script + strings.Replace(workerBody, "\"", e.options.QuoteStyle, -1), nil
+}